@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2 (RFC 9106, version 0x13). golang.org/x/crypto/argon2 only exposes
+// Argon2i and Argon2id but KeePass defaults to Argon2d, so the KDBX support
+// needs its own.
+
+const (
+	ARGON2D  = 0
+	ARGON2I  = 1
+	ARGON2ID = 2
+
+	argon2Version    = 0x13
+	argon2BlockWords = 128 // a block is 1KiB of uint64s
+	argon2SyncPoints = 4   // slices per pass
+)
+
+type argon2Block [argon2BlockWords]uint64
+
+// the most an Argon2 derivation read from a file may ask for; the header is
+// only authenticated by the key it derives, so a corrupt or crafted one
+// must not be able to take all the memory (or hours) first
+const (
+	ARGON2_MAX_MEMORY  = 2 * 1024 * 1024 // KiB, 2 GiB
+	ARGON2_MAX_TIME    = 1000
+	ARGON2_MAX_THREADS = 256
+)
+
+// CheckArgon2 fails for parameters (memory in KiB) that are invalid or over
+// the limits, before anything is allocated
+func CheckArgon2(time uint64, memory uint64, threads uint64) error {
+	if time == 0 || threads == 0 || memory < 8*threads {
+		return fmt.Errorf("invalid Argon2 parameters")
+	}
+	if time > ARGON2_MAX_TIME || memory > ARGON2_MAX_MEMORY || threads > ARGON2_MAX_THREADS {
+		return fmt.Errorf("the Argon2 parameters (%v iterations, %v KiB, %v threads) are over the limits of %v, %v KiB and %v",
+			time, memory, threads, ARGON2_MAX_TIME, ARGON2_MAX_MEMORY, ARGON2_MAX_THREADS)
+	}
+	return nil
+}
+
+// Argon2 derives keyLen bytes; memory is in KiB
+func Argon2(variant int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) []byte {
+	h0 := argon2InitialHash(variant, password, salt, secret, data, time, memory, threads, keyLen)
+
+	memory = memory / (argon2SyncPoints * threads) * (argon2SyncPoints * threads)
+	if memory < 2*argon2SyncPoints*threads {
+		memory = 2 * argon2SyncPoints * threads
+	}
+	laneLength := memory / threads
+	segmentLength := laneLength / argon2SyncPoints
+	blocks := make([]argon2Block, memory)
+
+	var buffer [1024]byte
+	input := make([]byte, len(h0)+8)
+	copy(input, h0[:])
+	for lane := uint32(0); lane < threads; lane++ {
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(input[len(h0):], i)
+			binary.LittleEndian.PutUint32(input[len(h0)+4:], lane)
+			argon2Hash(buffer[:], input)
+			argon2BytesToBlock(&blocks[lane*laneLength+i], buffer[:])
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < threads; lane++ {
+				argon2Segment(blocks, variant, pass, slice, lane, time, memory, threads, laneLength, segmentLength)
+			}
+		}
+	}
+
+	final := blocks[laneLength-1]
+	for lane := uint32(1); lane < threads; lane++ {
+		last := &blocks[lane*laneLength+laneLength-1]
+		for i := range final {
+			final[i] ^= last[i]
+		}
+	}
+	for i, v := range final {
+		binary.LittleEndian.PutUint64(buffer[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, buffer[:])
+	return key
+}
+
+func argon2InitialHash(variant int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) [blake2b.Size]byte {
+	h, _ := blake2b.New512(nil)
+	writeUint32 := func(v uint32) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		h.Write(b[:])
+	}
+	writeBytes := func(b []byte) {
+		writeUint32(uint32(len(b)))
+		h.Write(b)
+	}
+	writeUint32(threads)
+	writeUint32(keyLen)
+	writeUint32(memory)
+	writeUint32(time)
+	writeUint32(argon2Version)
+	writeUint32(uint32(variant))
+	writeBytes(password)
+	writeBytes(salt)
+	writeBytes(secret)
+	writeBytes(data)
+	var h0 [blake2b.Size]byte
+	h.Sum(h0[:0])
+	return h0
+}
+
+func argon2Segment(blocks []argon2Block, variant int, pass, slice, lane, time, memory, threads, laneLength, segmentLength uint32) {
+	dataIndependent := variant == ARGON2I || (variant == ARGON2ID && pass == 0 && slice < argon2SyncPoints/2)
+	var addresses, input, zero argon2Block
+	if dataIndependent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(memory)
+		input[4] = uint64(time)
+		input[5] = uint64(variant)
+	}
+	nextAddresses := func() {
+		input[6]++
+		argon2Compress(&addresses, &zero, &input, false)
+		argon2Compress(&addresses, &zero, &addresses, false)
+	}
+
+	index := uint32(0)
+	if pass == 0 && slice == 0 {
+		// the first two blocks of each lane come from the initial hash
+		index = 2
+		if dataIndependent {
+			nextAddresses()
+		}
+	}
+
+	offset := lane*laneLength + slice*segmentLength + index
+	for ; index < segmentLength; index, offset = index+1, offset+1 {
+		previous := offset - 1
+		if index == 0 && slice == 0 {
+			previous += laneLength
+		}
+		var random uint64
+		if dataIndependent {
+			if index%argon2BlockWords == 0 {
+				nextAddresses()
+			}
+			random = addresses[index%argon2BlockWords]
+		} else {
+			random = blocks[previous][0]
+		}
+
+		refLane := uint32(random>>32) % threads
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+		var area, start uint32
+		if pass == 0 {
+			area = slice * segmentLength
+			if slice == 0 || refLane == lane {
+				area += index
+			}
+		} else {
+			area = laneLength - segmentLength
+			if refLane == lane {
+				area += index
+			}
+			start = ((slice + 1) % argon2SyncPoints) * segmentLength
+		}
+		if index == 0 || refLane == lane {
+			area--
+		}
+		x := random & 0xFFFFFFFF
+		x = (x * x) >> 32
+		y := (uint64(area) * x) >> 32
+		ref := refLane*laneLength + uint32((uint64(start)+uint64(area)-1-y)%uint64(laneLength))
+
+		argon2Compress(&blocks[offset], &blocks[previous], &blocks[ref], pass > 0)
+	}
+}
+
+// argon2Compress sets out to G(x, y), XORed with the existing out when xor
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, z argon2Block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	z = r
+	for i := 0; i < 8; i++ {
+		row := z[i*16 : i*16+16]
+		argon2Permute(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5], &row[6], &row[7],
+			&row[8], &row[9], &row[10], &row[11], &row[12], &row[13], &row[14], &row[15])
+	}
+	for i := 0; i < 8; i++ {
+		c := 2 * i
+		argon2Permute(&z[c], &z[c+1], &z[c+16], &z[c+17], &z[c+32], &z[c+33], &z[c+48], &z[c+49],
+			&z[c+64], &z[c+65], &z[c+80], &z[c+81], &z[c+96], &z[c+97], &z[c+112], &z[c+113])
+	}
+	for i := range out {
+		if xor {
+			out[i] ^= z[i] ^ r[i]
+		} else {
+			out[i] = z[i] ^ r[i]
+		}
+	}
+}
+
+func argon2Permute(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	argon2G(v0, v4, v8, v12)
+	argon2G(v1, v5, v9, v13)
+	argon2G(v2, v6, v10, v14)
+	argon2G(v3, v7, v11, v15)
+	argon2G(v0, v5, v10, v15)
+	argon2G(v1, v6, v11, v12)
+	argon2G(v2, v7, v8, v13)
+	argon2G(v3, v4, v9, v14)
+}
+
+func argon2G(a, b, c, d *uint64) {
+	mul := func(x, y uint64) uint64 { return 2 * (x & 0xFFFFFFFF) * (y & 0xFFFFFFFF) }
+	*a = *a + *b + mul(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -32)
+	*c = *c + *d + mul(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -24)
+	*a = *a + *b + mul(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -16)
+	*c = *c + *d + mul(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -63)
+}
+
+// argon2Hash is the variable-length hash H' from the RFC
+func argon2Hash(out []byte, in []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		h.Write(length[:])
+		h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+	h, _ := blake2b.New512(nil)
+	h.Write(length[:])
+	h.Write(in)
+	v := h.Sum(nil)
+	copy(out, v[:32])
+	remaining := out[32:]
+	for len(remaining) > blake2b.Size {
+		sum := blake2b.Sum512(v)
+		v = sum[:]
+		copy(remaining, v[:32])
+		remaining = remaining[32:]
+	}
+	h, _ = blake2b.New(len(remaining), nil)
+	h.Write(v)
+	h.Sum(remaining[:0])
+}
+
+func argon2BytesToBlock(b *argon2Block, data []byte) {
+	for i := range b {
+		b[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2dVector(t *testing.T) {
+	// RFC 9106 section 5.1
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+	tag := Argon2(ARGON2D, password, salt, secret, data, 3, 32, 4, 32)
+	expected := "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"
+	if hex.EncodeToString(tag) != expected {
+		t.Fatalf("expected %v, got %x", expected, tag)
+	}
+}
+
+func TestArgon2idMatchesXCrypto(t *testing.T) {
+	password := []byte("correct horse battery staple")
+	salt := []byte("0123456789abcdef")
+	expected := argon2.IDKey(password, salt, 2, 256, 2, 32)
+	actual := Argon2(ARGON2ID, password, salt, nil, nil, 2, 256, 2, 32)
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("expected %x, got %x", expected, actual)
+	}
+}
+
+func TestCheckArgon2(t *testing.T) {
+	if err := CheckArgon2(2, 64*1024, 2); err != nil {
+		t.Fatalf("expected the defaults to pass, got %v", err)
+	}
+	for _, params := range [][3]uint64{{0, 1024, 1}, {1, 1024, 0}, {1, 4, 1}, {ARGON2_MAX_TIME + 1, 1024, 1}, {1, ARGON2_MAX_MEMORY + 1, 1}, {1, 1 << 40, 1}, {1, 1 << 20, ARGON2_MAX_THREADS + 1}} {
+		if err := CheckArgon2(params[0], params[1], params[2]); err == nil {
+			t.Errorf("expected %v to fail", params)
+		}
+	}
+
+	// a KDBX header asking for a terabyte fails before allocating it
+	params := map[string]interface{}{"$UUID": kdbxKdfArgon2d, "S": make([]byte, 32), "P": uint32(1), "M": uint64(1 << 40), "I": uint64(1), "V": uint32(argon2Version)}
+	if _, err := kdbxTransformKey(make([]byte, 32), params); err == nil {
+		t.Fatalf("expected the memory to be refused")
+	}
+	params = map[string]interface{}{"$UUID": kdbxKdfAES, "S": make([]byte, 32), "R": uint64(1 << 62)}
+	if _, err := kdbxTransformKey(make([]byte, 32), params); err == nil {
+		t.Fatalf("expected the rounds to be refused")
+	}
+}
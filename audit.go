@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// the checks kp audit makes
+const (
+	AUDIT_WEAK        = "weak"
+	AUDIT_REUSED      = "reused"
+	AUDIT_OLD         = "old"
+	AUDIT_NO_USERNAME = "no-username"
+	AUDIT_BREACHED    = "breached"
+	AUDIT_UNREADABLE  = "unreadable" // the value cannot be decrypted, so was not checked
+	AUDIT_UNCHECKED   = "unchecked"  // the value could not be looked up in the breach index
+)
+
+// the priorities of findings, most urgent first
+const (
+	PRIORITY_HIGH   = "high"
+	PRIORITY_MEDIUM = "medium"
+	PRIORITY_LOW    = "low"
+)
+
+var PRIORITIES = []string{PRIORITY_HIGH, PRIORITY_MEDIUM, PRIORITY_LOW}
+
+// the audit's thresholds: values under AUDIT_MIN_ENTROPY bits are flagged,
+// and under AUDIT_WEAK_ENTROPY with high priority
+const (
+	AUDIT_MIN_ENTROPY  = 60
+	AUDIT_WEAK_ENTROPY = 40
+	AUDIT_MAX_AGE_DAYS = 365
+)
+
+// AuditFinding is a problem with one entry (or, for reuse, several)
+type AuditFinding struct {
+	Priority string   `json:"priority"`
+	Check    string   `json:"check"`
+	Keys     []string `json:"keys"`
+	Message  string   `json:"message"`
+}
+
+// AuditReport is what kp audit found, most urgent first
+type AuditReport struct {
+	Entries  int            `json:"entries"`
+	Findings []AuditFinding `json:"findings"`
+	Counts   map[string]int `json:"counts"` // findings by priority
+}
+
+// AuditOptions are the thresholds of the audit
+type AuditOptions struct {
+	MinEntropy    float64
+	MaxAge        time.Duration
+	IncludeHidden bool
+	Now           time.Time
+	Breach        *BreachIndex // when set, values are looked up in it
+}
+
+// Audit decrypts each entry in turn and checks its strength (and whether it
+// has been in a breach), keeping only a hash of the value to find the ones
+// that are reused. An entry that cannot be decrypted, or looked up, is a
+// high priority finding, so the audit never passes without checking it.
+func Audit(db *KPDB, options AuditOptions) AuditReport {
+	report := AuditReport{Findings: make([]AuditFinding, 0), Counts: make(map[string]int)}
+	add := func(priority string, check string, keys []string, format string, args ...interface{}) {
+		report.Findings = append(report.Findings, AuditFinding{priority, check, keys, fmt.Sprintf(format, args...)})
+	}
+
+	hashes := make(map[[sha256.Size]byte][]string)
+	for _, entry := range db.GetEntriesSortedByUpdatedThenKey() {
+		if entry.Hidden && !options.IncludeHidden {
+			continue
+		}
+		report.Entries++
+		value, err := db.Decrypt(entry.Value)
+		if err != nil {
+			add(PRIORITY_HIGH, AUDIT_UNREADABLE, []string{entry.Key}, "cannot be decrypted, so was not checked")
+			continue
+		}
+		if value != "" {
+			hash := sha256.Sum256([]byte(value))
+			hashes[hash] = append(hashes[hash], entry.Key)
+
+			if options.Breach != nil {
+				count, err := options.Breach.Count(value)
+				if err != nil {
+					add(PRIORITY_HIGH, AUDIT_UNCHECKED, []string{entry.Key}, "cannot be looked up in the breach index: %v", err)
+				} else if count > 0 {
+					add(PRIORITY_HIGH, AUDIT_BREACHED, []string{entry.Key}, "seen %v times in breaches", count)
+				}
+			}
+
+			strength := EstimateStrength(value)
+			if strength.Entropy < options.MinEntropy {
+				priority := PRIORITY_MEDIUM
+				if strength.Entropy < AUDIT_WEAK_ENTROPY {
+					priority = PRIORITY_HIGH
+				}
+				message := fmt.Sprintf("%.0f bits of entropy", strength.Entropy)
+				if len(strength.Patterns) > 0 {
+					message += fmt.Sprintf(" (%v)", strings.Join(strength.Patterns, ", "))
+				}
+				add(priority, AUDIT_WEAK, []string{entry.Key}, "%v", message)
+			}
+		}
+		if age := options.Now.Sub(entry.LastUpdated); options.MaxAge > 0 && age > options.MaxAge {
+			add(PRIORITY_MEDIUM, AUDIT_OLD, []string{entry.Key}, "unchanged for %v days", int(age.Hours()/24))
+		}
+		if entry.Url != "" && entry.Username == "" {
+			add(PRIORITY_LOW, AUDIT_NO_USERNAME, []string{entry.Key}, "has a url but no username")
+		}
+	}
+	for _, keys := range hashes {
+		if len(keys) > 1 {
+			add(PRIORITY_HIGH, AUDIT_REUSED, keys, "the same value is used by %v keys", len(keys))
+		}
+	}
+
+	rank := func(priority string) int {
+		for i, p := range PRIORITIES {
+			if p == priority {
+				return i
+			}
+		}
+		return len(PRIORITIES)
+	}
+	sort.SliceStable(report.Findings, func(a int, b int) bool {
+		fa, fb := report.Findings[a], report.Findings[b]
+		if rank(fa.Priority) != rank(fb.Priority) {
+			return rank(fa.Priority) < rank(fb.Priority)
+		}
+		if fa.Check != fb.Check {
+			return fa.Check < fb.Check
+		}
+		return strings.ToLower(fa.Keys[0]) < strings.ToLower(fb.Keys[0])
+	})
+	for _, finding := range report.Findings {
+		report.Counts[finding.Priority]++
+	}
+	return report
+}
+
+// Failing is true when there are findings at priority or more urgent
+func (r AuditReport) Failing(priority string) bool {
+	for _, p := range PRIORITIES {
+		if r.Counts[p] > 0 {
+			return true
+		}
+		if p == priority {
+			break
+		}
+	}
+	return false
+}
+
+// Print writes the findings a line each, most urgent first
+func (r AuditReport) Print() {
+	for _, finding := range r.Findings {
+		fmt.Printf("%-7v %-12v %v: %v\n", strings.ToUpper(finding.Priority), finding.Check,
+			strings.Join(finding.Keys, ", "), finding.Message)
+	}
+	if len(r.Findings) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("%v high, %v medium, %v low in %v entries.\n",
+		r.Counts[PRIORITY_HIGH], r.Counts[PRIORITY_MEDIUM], r.Counts[PRIORITY_LOW], r.Entries)
+}
+
+// DoAudit is "kp audit"; it exits 1 when there are findings at -fail-on
+// priority or above, for use in CI
+func DoAudit(c *cli.CLI) {
+	failOn := FlagString(c, "-fail-on", PRIORITY_LOW)
+	if !contains(PRIORITIES, failOn) {
+		Fail(c, ERR_USAGE, "Error, -fail-on is one of %v", strings.Join(PRIORITIES, ", "))
+	}
+	options := AuditOptions{
+		MinEntropy:    float64(FlagInt(c, "-min-entropy", AUDIT_MIN_ENTROPY)),
+		MaxAge:        time.Duration(FlagInt(c, "-days", AUDIT_MAX_AGE_DAYS)) * 24 * time.Hour,
+		IncludeHidden: HasFlag(c, "-a"),
+		Now:           time.Now(),
+	}
+	if HasFlag(c, "-breach") {
+		breach, err := OpenBreachIndex(goutils.EvaluateFilename(FlagString(c, "-breach", "")))
+		if err != nil {
+			Fail(c, ERR_NOT_FOUND, "Error, %v", err)
+		}
+		options.Breach = breach
+	}
+	report := Audit(LoadDB(), options)
+	if IsJSON(c) {
+		PrintJSON(c, report)
+	} else {
+		report.Print()
+	}
+	if report.Failing(failOn) {
+		os.Exit(1)
+	}
+}
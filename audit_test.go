@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	weak := []string{"password123", "P@ssw0rd1", "qwerty", "aaaaaaaa", "abcdefgh", "hunter2"}
+	for _, value := range weak {
+		if strength := EstimateStrength(value); strength.Entropy >= AUDIT_WEAK_ENTROPY || len(strength.Patterns) == 0 {
+			t.Errorf("expected %q to be weak, got %+v", value, strength)
+		}
+	}
+	strong := []string{"J^:n%YVV6(>:tG#*MnAb%N[P5E&#v3tl", "fraternal espresso freedom eastbound autism preseason"}
+	for _, value := range strong {
+		if strength := EstimateStrength(value); strength.Entropy < AUDIT_MIN_ENTROPY {
+			t.Errorf("expected %q to be strong, got %+v", value, strength)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	db := newTestDB(t)
+	strong := "J^:n%YVV6(>:tG#*MnAb%N[P5E&#v3tl"
+	db.Put(DBEntry{Key: "github", Value: "password123", Url: "https://github.com", Username: "bob"})
+	db.Put(DBEntry{Key: "aws", Value: strong, Username: "root"})
+	db.Put(DBEntry{Key: "gcp", Value: strong, Username: "root"})
+	db.Put(DBEntry{Key: "site", Value: "Tr0ub4dor&3xK9#mQ2$vL", Url: "https://example.com"})
+	old := db.GetData().Entries["site"]
+	old.LastUpdated = time.Now().Add(-400 * 24 * time.Hour)
+	db.GetData().Entries["site"] = old
+
+	options := AuditOptions{MinEntropy: AUDIT_MIN_ENTROPY, MaxAge: AUDIT_MAX_AGE_DAYS * 24 * time.Hour, Now: time.Now()}
+	report := Audit(db, options)
+	checks := make([]string, 0)
+	for _, finding := range report.Findings {
+		checks = append(checks, finding.Priority+":"+finding.Check+":"+strings.Join(finding.Keys, ","))
+	}
+	expected := "high:reused:aws,gcp high:weak:github medium:old:site low:no-username:site"
+	if strings.Join(checks, " ") != expected {
+		t.Fatalf("unexpected findings %v", checks)
+	}
+	if report.Entries != 4 || !report.Failing(PRIORITY_HIGH) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// a value that cannot be decrypted fails the audit
+	broken := db.GetData().Entries["aws"]
+	broken.Value = "not a ciphertext"
+	db.GetData().Entries["aws"] = broken
+	report = Audit(db, options)
+	if finding := report.Findings[0]; finding.Check != AUDIT_UNREADABLE || finding.Keys[0] != "aws" || !report.Failing(PRIORITY_HIGH) {
+		t.Fatalf("expected aws to be unreadable, got %+v", report.Findings)
+	}
+
+	report = AuditReport{Counts: map[string]int{PRIORITY_LOW: 1}}
+	if report.Failing(PRIORITY_MEDIUM) || !report.Failing(PRIORITY_LOW) {
+		t.Fatalf("only low findings should fail -fail-on low")
+	}
+}
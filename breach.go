@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// HIBP_PREFIX_LENGTH is how many hex characters of the hash name a range file
+const HIBP_PREFIX_LENGTH = 5
+
+// BreachIndex looks up passwords in a local copy of the Have I Been Pwned
+// SHA-1 passwords: either the one file ordered by hash ("HASH:COUNT" lines)
+// or a directory of range files named by the first five characters of the
+// hash ("5BAA6.txt", holding "SUFFIX:COUNT" lines). Nothing is sent anywhere.
+type BreachIndex struct {
+	Path  string
+	Range bool // Path is a directory of range files
+}
+
+// OpenBreachIndex checks the path is a file or a directory of range files
+func OpenBreachIndex(path string) (*BreachIndex, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &BreachIndex{Path: path, Range: info.IsDir()}, nil
+}
+
+// BreachHash is the upper case hex SHA-1 of a value, as HIBP lists them
+func BreachHash(value string) string {
+	return fmt.Sprintf("%X", sha1.Sum([]byte(value)))
+}
+
+// Count is how many times the value was seen in breaches, 0 if never
+func (b *BreachIndex) Count(value string) (int, error) {
+	hash := BreachHash(value)
+	if !b.Range {
+		return searchHashFile(b.Path, hash)
+	}
+	prefix, suffix := hash[:HIBP_PREFIX_LENGTH], hash[HIBP_PREFIX_LENGTH:]
+	for _, name := range []string{prefix + ".txt", prefix} {
+		filename := filepath.Join(b.Path, name)
+		if _, err := os.Stat(filename); err == nil {
+			return searchHashFile(filename, suffix)
+		}
+	}
+	return 0, fmt.Errorf("there is no range file for %v in %v", prefix, b.Path)
+}
+
+// searchHashFile binary searches a file of "HASH:COUNT" lines sorted by hash
+// for the count of one hash, reading only the lines it compares
+func searchHashFile(filename string, hash string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// the lines starting in [lo, hi) are the ones left to search
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineFrom(file, mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+		key, count, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ":")
+		switch strings.Compare(strings.ToUpper(key), hash) {
+		case -1:
+			lo = start + int64(len(line))
+		case 1:
+			hi = mid
+		default:
+			return strconv.Atoi(strings.TrimSpace(count))
+		}
+	}
+	return 0, nil
+}
+
+// lineFrom reads the first line that starts at or after offset, returning
+// where it starts and the line with its line ending
+func lineFrom(file *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// skip the rest of the line offset is in (or just the newline
+		// before it, if it starts a line)
+		reader := bufio.NewReader(io.NewSectionReader(file, offset-1, 1<<62))
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return offset - 1 + int64(len(skipped)), "", nil
+		} else if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+	reader := bufio.NewReader(io.NewSectionReader(file, start, 1<<62))
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, line, nil
+}
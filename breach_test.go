@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreachIndexFile(t *testing.T) {
+	index, err := OpenBreachIndex("testdata/hibp-sample.txt")
+	if err != nil || index.Range {
+		t.Fatalf("cannot open the sample: %v", err)
+	}
+	for value, expected := range map[string]int{"password": 9545824, "hunter2": 7243, "J^:n%YVV6(>:tG#*MnAb": 0} {
+		count, err := index.Count(value)
+		if err != nil || count != expected {
+			t.Errorf("expected %q to be seen %v times, got %v (%v)", value, expected, count, err)
+		}
+	}
+	// every line of the sample can be found, the first and last included
+	sample, err := os.ReadFile("testdata/hibp-sample.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(sample)), "\n") {
+		hash, _, _ := strings.Cut(line, ":")
+		if count, err := searchHashFile("testdata/hibp-sample.txt", hash); err != nil || count == 0 {
+			t.Errorf("cannot find %v: %v", hash, err)
+		}
+	}
+}
+
+func TestBreachIndexRange(t *testing.T) {
+	index, err := OpenBreachIndex("testdata/hibp-ranges")
+	if err != nil || !index.Range {
+		t.Fatalf("cannot open the ranges: %v", err)
+	}
+	for _, value := range []string{"password", "hunter2"} {
+		if count, err := index.Count(value); err != nil || count == 0 {
+			t.Errorf("expected %q to be found, got %v (%v)", value, count, err)
+		}
+	}
+	if _, err := index.Count("no range file for this"); err == nil {
+		t.Errorf("expected an error when the range file is missing")
+	}
+	if _, err := OpenBreachIndex("testdata/missing"); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestAuditBreach(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "github", Value: "password"})
+	db.Put(DBEntry{Key: "aws", Value: "J^:n%YVV6(>:tG#*MnAb%N[P5E&#v3tl"})
+	index, _ := OpenBreachIndex("testdata/hibp-sample.txt")
+
+	options := AuditOptions{MinEntropy: AUDIT_MIN_ENTROPY, Now: time.Now(), Breach: index}
+	report := Audit(db, options)
+	breached := make([]string, 0)
+	for _, finding := range report.Findings {
+		if finding.Check == AUDIT_BREACHED {
+			breached = append(breached, finding.Keys[0]+": "+finding.Message)
+		}
+	}
+	if strings.Join(breached, ",") != "github: seen 9545824 times in breaches" {
+		t.Fatalf("unexpected breach findings %v", breached)
+	}
+
+	// a value that cannot be looked up fails the audit
+	options.Breach, _ = OpenBreachIndex(t.TempDir())
+	report = Audit(db, options)
+	unchecked := 0
+	for _, finding := range report.Findings {
+		if finding.Check == AUDIT_UNCHECKED && finding.Priority == PRIORITY_HIGH {
+			unchecked++
+		}
+	}
+	if unchecked != 2 || !report.Failing(PRIORITY_HIGH) {
+		t.Fatalf("expected both values to be unchecked, got %+v", report.Findings)
+	}
+}
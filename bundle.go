@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	goutils "github.com/simonski/goutils"
+	crypto "github.com/simonski/goutils/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+// A bundle (.kpx) is a whole vault - values, metadata, tags, hidden flags and
+// history - re-encrypted with AES-256-GCM so it can be opened on a machine
+// with a different key. The AES key is derived from a passphrase (Argon2id)
+// or is random and wrapped with the recipient's RSA public key.
+
+const (
+	BUNDLE_FORMAT  = "kpx"
+	BUNDLE_VERSION = 1
+
+	BUNDLE_PASSPHRASE = "passphrase"
+	BUNDLE_RECIPIENT  = "recipient"
+)
+
+// BUNDLE_ARGON2 are the Argon2id parameters used when writing; memory in KiB
+var BUNDLE_ARGON2 = BundleKDF{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// ErrBundlePassphrase is returned when the bundle does not decrypt
+var ErrBundlePassphrase = errors.New("wrong passphrase (or the bundle is corrupt)")
+
+// Bundle is the file written by "kp export kpx"
+type Bundle struct {
+	Format  string     `json:"format"`
+	Version int        `json:"version"`
+	Mode    string     `json:"mode"`
+	KDF     *BundleKDF `json:"kdf,omitempty"`
+	Key     []byte     `json:"key,omitempty"` // the AES key, wrapped for the recipient
+	Nonce   []byte     `json:"nonce"`
+	Data    []byte     `json:"data"` // the sealed BundleData
+}
+
+// BundleKDF records how the passphrase became the AES key
+type BundleKDF struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// BundleData is what is sealed inside a bundle; values are in plaintext
+type BundleData struct {
+	Version string             `json:"version"`
+	Entries []DBEntry          `json:"entries"`
+	History map[string]DBEntry `json:"history"`
+
+	Rotation *RotationRules `json:"rotation,omitempty"`
+}
+
+// SealBundle encrypts data with the passphrase, or for the recipient when
+// the public key is set; the passphrase cannot be empty
+func SealBundle(data BundleData, passphrase string, recipient *rsa.PublicKey) (*Bundle, error) {
+	if recipient == nil && passphrase == "" {
+		return nil, fmt.Errorf("a bundle cannot be sealed with an empty passphrase")
+	}
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{Format: BUNDLE_FORMAT, Version: BUNDLE_VERSION}
+	var key []byte
+	if recipient != nil {
+		bundle.Mode = BUNDLE_RECIPIENT
+		key = randomBytes(32)
+		bundle.Key, err = crypto.EncryptWithPublicKey(key, recipient)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bundle.Mode = BUNDLE_PASSPHRASE
+		kdf := BUNDLE_ARGON2
+		kdf.Salt = randomBytes(16)
+		bundle.KDF = &kdf
+		key = kdf.Key(passphrase)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Nonce = randomBytes(gcm.NonceSize())
+	bundle.Data = gcm.Seal(nil, bundle.Nonce, plaintext, bundle.header())
+	return bundle, nil
+}
+
+// Open decrypts the bundle with the passphrase, or with the private key for
+// a recipient bundle
+func (b *Bundle) Open(passphrase string, privateKey *rsa.PrivateKey) (BundleData, error) {
+	data := BundleData{}
+	var key []byte
+	switch b.Mode {
+	case BUNDLE_RECIPIENT:
+		if privateKey == nil {
+			return data, errors.New("the bundle is for a recipient, but there is no private key")
+		}
+		var err error
+		key, err = crypto.DecryptWithPrivateKey(b.Key, privateKey)
+		if err != nil {
+			return data, errors.New("the bundle was not encrypted for this key")
+		}
+	case BUNDLE_PASSPHRASE:
+		if b.KDF == nil {
+			return data, errors.New("the bundle has no kdf parameters")
+		}
+		if err := CheckArgon2(uint64(b.KDF.Time), uint64(b.KDF.Memory), uint64(b.KDF.Threads)); err != nil {
+			return data, err
+		}
+		key = b.KDF.Key(passphrase)
+	default:
+		return data, fmt.Errorf("unknown bundle mode '%v'", b.Mode)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return data, err
+	}
+	plaintext, err := gcm.Open(nil, b.Nonce, b.Data, b.header())
+	if err != nil {
+		return data, ErrBundlePassphrase
+	}
+	err = json.Unmarshal(plaintext, &data)
+	return data, err
+}
+
+// header is authenticated with the data, so the mode and kdf cannot be
+// swapped out
+func (b *Bundle) header() []byte {
+	header := *b
+	header.Nonce = nil
+	header.Data = nil
+	bytes, _ := json.Marshal(header)
+	return bytes
+}
+
+// Key derives the AES key from the passphrase
+func (k BundleKDF) Key(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), k.Salt, k.Time, k.Memory, k.Threads, 32)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(size int) []byte {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// ReadBundleFile reads a bundle without decrypting it
+func ReadBundleFile(filename string) (*Bundle, error) {
+	data, err := os.ReadFile(goutils.EvaluateFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{}
+	if err := json.Unmarshal(data, bundle); err != nil || bundle.Format != BUNDLE_FORMAT {
+		return nil, fmt.Errorf("%v is not a kp bundle", filename)
+	}
+	if bundle.Version > BUNDLE_VERSION {
+		return nil, fmt.Errorf("%v is a version %v bundle, this kp reads up to version %v", filename, bundle.Version, BUNDLE_VERSION)
+	}
+	return bundle, nil
+}
+
+// WriteBundleFile writes the bundle with 0600 permissions
+func WriteBundleFile(filename string, bundle *Bundle) error {
+	data, err := json.MarshalIndent(bundle, "", " ")
+	if err != nil {
+		return err
+	}
+	return WritePrivateFile(filename, data)
+}
+
+// LoadRecipientKey reads an RSA public key from a PEM file (PKCS1 or PKIX),
+// an OpenSSH public key (id_rsa.pub) or a private key
+func LoadRecipientKey(filename string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(goutils.EvaluateFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(data), "ssh-") {
+		sshKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, err
+		}
+		if cryptoKey, ok := sshKey.(ssh.CryptoPublicKey); ok {
+			if key, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not an RSA key", filename)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%v is not a PEM or OpenSSH public key", filename)
+	}
+	if strings.Contains(block.Type, "PRIVATE") {
+		private, err := crypto.BytesToPrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		return &private.PublicKey, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%v is not an RSA key", filename)
+	}
+	return key, nil
+}
+
+// ExportBundle collects the whole vault, decrypted, for a bundle; it fails
+// when any value, current or in the history, cannot be decrypted rather
+// than export its ciphertext as if it were the value
+func ExportBundle(db *KPDB) (BundleData, error) {
+	entries, err := decryptEntries(db)
+	if err != nil {
+		return BundleData{}, err
+	}
+	data := BundleData{Version: db.GetData().Version, Entries: entries, History: make(map[string]DBEntry), Rotation: db.GetData().Rotation.clone()}
+	for id, entry := range db.GetData().History {
+		value, err := db.Decrypt(entry.Value)
+		if err != nil {
+			return BundleData{}, fmt.Errorf("cannot decrypt the history of '%v' (%v) in %v with %v", entry.Key, id, db.Filename, db.PrivateKeyFilename)
+		}
+		entry.Value = value
+		data.History[id] = entry
+	}
+	return data, nil
+}
+
+// ImportBundle merges the bundle's entries into the db using the conflict
+// policy, and adds any history and rotation rules the db does not already
+// have
+func ImportBundle(db *KPDB, data BundleData, policy string, dryRun bool) ImportSummary {
+	summary := ImportEntries(db, data.Entries, policy, dryRun)
+	if dryRun {
+		return summary
+	}
+	if db.GetData().History == nil {
+		db.GetData().History = make(map[string]DBEntry)
+	}
+	for id, entry := range data.History {
+		if _, exists := db.GetData().History[id]; exists {
+			continue
+		}
+		entry.Value, _ = db.Encrypt(entry.Value)
+		db.GetData().History[id] = entry
+	}
+	db.GetData().Rotation = MergeRotationRules(db.GetData().Rotation, data.Rotation)
+	return summary
+}
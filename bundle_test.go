@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	crypto "github.com/simonski/goutils/crypto"
+)
+
+func TestBundlePassphrase(t *testing.T) {
+	kdf := BUNDLE_ARGON2
+	BUNDLE_ARGON2.Memory = 1024
+	defer func() { BUNDLE_ARGON2 = kdf }()
+
+	data := BundleData{Entries: []DBEntry{{Key: "a", Value: "secret", Hidden: true, Tags: tagSet([]string{"work"})}}}
+	bundle, err := SealBundle(data, "pw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SealBundle(data, "", nil); err == nil {
+		t.Fatalf("expected an empty passphrase to be refused")
+	}
+	if _, err := bundle.Open("wrong", nil); err != ErrBundlePassphrase {
+		t.Fatalf("expected ErrBundlePassphrase, got %v", err)
+	}
+	opened, err := bundle.Open("pw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := opened.Entries[0]
+	if e.Key != "a" || e.Value != "secret" || !e.Hidden || !e.Tags["work"] {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+
+	bundle.KDF.Time++
+	if _, err := bundle.Open("pw", nil); err == nil {
+		t.Fatalf("expected a tampered header to fail")
+	}
+
+	// parameters over the limits fail before the key is derived
+	bundle.KDF.Memory = 1 << 31
+	if _, err := bundle.Open("pw", nil); err == nil || !strings.Contains(err.Error(), "limits") {
+		t.Fatalf("expected the memory to be refused, got %v", err)
+	}
+	bundle.KDF.Memory, bundle.KDF.Threads = 1024, 0
+	if _, err := bundle.Open("pw", nil); err == nil {
+		t.Fatalf("expected no threads to be refused")
+	}
+}
+
+func TestBundleRecipient(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "secret"})
+	db.GetData().History["a-1"] = DBEntry{Key: "a", Value: db.GetData().Entries["a"].Value}
+	db.GetData().Rotation = &RotationRules{Types: map[string]int{"db-password": 30}, Tags: map[string]int{"prod": 90}}
+
+	privateKey, err := crypto.LoadPrivateKey(db.PrivateKeyFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ExportBundle(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := SealBundle(exported, "", &privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bundle.Open("", privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Entries[0].Value != "secret" || data.History["a-1"].Value != "secret" {
+		t.Fatalf("unexpected bundle %+v", data)
+	}
+
+	other := newTestDB(t)
+	other.GetData().Rotation = &RotationRules{Types: map[string]int{"db-password": 7}, Tags: map[string]int{}}
+	ImportBundle(other, data, CONFLICT_SKIP, false)
+	if e, _ := other.GetDecrypted("a"); e.Value != "secret" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if _, exists := other.GetData().History["a-1"]; !exists {
+		t.Fatalf("expected the history to be imported")
+	}
+	// a history value that cannot be decrypted fails the export rather
+	// than go in as ciphertext
+	db.GetData().History["a-2"] = DBEntry{Key: "a", Value: "not a ciphertext"}
+	if _, err := ExportBundle(db); err == nil || !strings.Contains(err.Error(), "history of 'a'") {
+		t.Fatalf("expected the export to fail, got %v", err)
+	}
+	// rules the vault already has are kept
+	if rules := other.GetData().Rotation; rules.Types["db-password"] != 7 || rules.Tags["prod"] != 90 {
+		t.Fatalf("expected the rotation rules to be merged, got %+v", rules)
+	}
+}
+
+func TestImportNewest(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "current"})
+
+	older := []DBEntry{{Key: "a", Value: "older", LastUpdated: time.Now().Add(-time.Hour)}}
+	if s := ImportEntries(db, older, CONFLICT_NEWEST, false); s.Count(IMPORT_SKIP) != 1 {
+		t.Fatalf("expected the older entry to be skipped")
+	}
+	newer := []DBEntry{{Key: "a", Value: "newer", LastUpdated: time.Now().Add(time.Hour)}}
+	if s := ImportEntries(db, newer, CONFLICT_NEWEST, false); s.Count(IMPORT_OVERWRITE) != 1 {
+		t.Fatalf("expected the newer entry to overwrite")
+	}
+	if e, _ := db.GetDecrypted("a"); e.Value != "newer" {
+		t.Fatalf("unexpected value %v", e.Value)
+	}
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	cli "github.com/simonski/cli"
+)
+
+// Flag is an option a command accepts
+type Flag struct {
+	Name          string   // e.g. "-url"
+	Value         string   // placeholder for the value, "" for a switch
+	Description   string   // one line for the usage text
+	Aliases       []string // other spellings that are accepted
+	OptionalValue bool     // the value can be left out, e.g. "-random [size]"
+}
+
+// Arg is a positional argument of a command
+type Arg struct {
+	Name     string // e.g. "key", "tag" or a set of choices "bash|zsh|fish"
+	Optional bool
+}
+
+// Command is an entry in the command registry
+type Command struct {
+	Name     string
+	Aliases  []string
+	Args     []Arg
+	Summary  string
+	Flags    []Flag
+	NoVerify bool // runs without verifying the encryption keys
+	Run      func(c *cli.CLI)
+}
+
+// GLOBAL_FLAGS are accepted by every command
+var GLOBAL_FLAGS = []Flag{
+	{Name: "-json", Description: "ls, get and describe print JSON (errors too)"},
+	{Name: "-jsonl", Description: "as -json but one compact object per line"},
+	{Name: "-g", Description: "launch the terminal UI"},
+	{Name: "-h", Description: "print help for the command", Aliases: []string{"-help"}},
+}
+
+// COMMANDS is the registry, in the order they appear in the usage
+var COMMANDS []*Command
+
+func init() {
+	metadataFlags := []Flag{
+		{Name: "-description", Value: "description", Description: "what the key is for"},
+		{Name: "-type", Value: "type", Description: "the kind of entry, e.g. login"},
+		{Name: "-url", Value: "url", Description: "the url the key is used with"},
+		{Name: "-username", Value: "username", Description: "the username that goes with the key"},
+		{Name: "-notes", Value: "notes", Description: "free text notes", Aliases: []string{"-note"}},
+	}
+	passphraseFlags := []Flag{
+		{Name: "-sep", Value: "separator", Description: "what goes between the words (default a space)"},
+		{Name: "-capitalize", Description: "capitalize each word"},
+		{Name: "-number", Description: "add a digit to one of the words"},
+	}
+
+	COMMANDS = []*Command{
+		{Name: "ls", Aliases: []string{"list"}, Args: []Arg{{Name: "search term or query", Optional: true}},
+			Summary: "list keys, searching or filtering with a query such as 'tag:prod updated<90d'",
+			Flags: []Flag{
+				{Name: "-a", Description: "include hidden keys"},
+				{Name: "-case-sensitive", Description: "match the search term's case exactly"},
+				{Name: "-tag", Value: "tag,tag", Description: "only keys with all of the tags"},
+				{Name: "-columns", Value: "key,username,...", Description: "the columns: key, username, url, type, tags, description, notes, created, updated, due"},
+				{Name: "-sort", Value: "key|created|updated|type", Description: "the order (dates newest first; default key, or best match)"},
+				{Name: "-reverse", Description: "reverse the order"},
+				{Name: "-compact", Description: "fewer columns and no borders (the default on narrow terminals)"},
+			},
+			Run: func(c *cli.CLI) { DoList(c, strings.Join(Positionals(c), " ")) }},
+		{Name: "put", Args: []Arg{{Name: "key"}},
+			Summary: "save \"key/value\" (typed twice, or piped on stdin)",
+			Flags: append([]Flag{
+				{Name: "-value", Value: "value", Description: "use this value rather than reading stdin"},
+				{Name: "-default", Value: "value", Description: "used when no value is entered"},
+				{Name: "-random", Value: "size", Description: "use a N-character random string", OptionalValue: true},
+				{Name: "-policy", Value: "policy", Description: "generate the value with a password policy (see kp policies)"},
+				{Name: "-passphrase", Value: "words", Description: "use a diceware passphrase of N words", OptionalValue: true},
+				{Name: "-file", Value: "path", Description: "read the value from a file"},
+				{Name: "-prompt", Value: "prompt", Description: "the prompt shown when typing the value"},
+				{Name: "-no-overwrite", Description: "fail if the key already exists"},
+			}, append(passphraseFlags, metadataFlags...)...),
+			Run: DoPut},
+		{Name: "get", Args: []Arg{{Name: "key"}},
+			Summary: "retrieve key/value to clipboard",
+			Flags:   []Flag{{Name: "-stdout", Description: "writes directly to stdout"}},
+			Run:     DoGet},
+		{Name: "qr", Args: []Arg{{Name: "key"}},
+			Summary: "show the value as a QR code in the terminal",
+			Flags: []Flag{
+				{Name: "-field", Value: "field", Description: "encode this field instead, e.g. username or url"},
+				{Name: "-wifi", Description: "encode a Wi-Fi network (the username is the SSID)"},
+				{Name: "-otp", Description: "encode an otpauth:// URI with the value as the TOTP secret"},
+				{Name: "-clear", Description: "show it on the alternate screen and erase it on a keypress"},
+				{Name: "-invert", Description: "for terminals with a light background"},
+			},
+			Run: DoQR},
+		{Name: "describe", Args: []Arg{{Name: "key"}},
+			Summary: "print the metadata of a key",
+			Run:     DoDescribe},
+		{Name: "update", Args: []Arg{{Name: "key"}},
+			Summary: "update metadata on the key",
+			Flags:   metadataFlags,
+			Run:     DoUpdate},
+		{Name: "open", Args: []Arg{{Name: "key"}},
+			Summary: "opens the url associated with the key",
+			Run:     DoOpen},
+		{Name: "env", Args: []Arg{{Name: "query", Optional: true}},
+			Summary: "print export lines for the matching entries, for eval \"$(kp env tag:dev)\"",
+			Flags: []Flag{
+				{Name: "-a", Description: "include hidden keys"},
+				{Name: "-i-understand", Description: "do not ask first, and export every entry when there is no query"},
+				{Name: "-stdout", Description: "print to a terminal"},
+			},
+			Run: DoEnv},
+		{Name: "inject",
+			Summary: "render a template, replacing {{ kp \"key\" \"field\" }} with values",
+			Flags: []Flag{
+				{Name: "-i", Value: "template", Description: "the template to render"},
+				{Name: "-o", Value: "output", Description: "written with 0600 permissions"},
+				{Name: "-stdout", Description: "writes directly to stdout"},
+			},
+			Run: DoInject},
+		{Name: "import", Args: []Arg{{Name: "csv|kdbx|kpx", Optional: true}, {Name: "file"}},
+			Summary: "import entries from another password manager",
+			Flags: []Flag{
+				{Name: "-groups", Value: "prefix|tags", Description: "kdbx groups become key prefixes (default) or tags"},
+				{Name: "-format", Value: "chrome|firefox|lastpass|bitwarden", Description: "the csv layout (detected from the header if omitted)"},
+				{Name: "-map", Value: "field=column,...", Description: "custom columns for key, value, url, username, notes, type, tags"},
+				{Name: "-on-conflict", Value: "skip|overwrite|suffix|newest", Description: "when a key already exists (default skip)"},
+				{Name: "-dry-run", Description: "list what would be imported without saving"},
+			},
+			Run: DoImport},
+		{Name: "export", Args: []Arg{{Name: "kdbx|kpx", Optional: true}, {Name: "file", Optional: true}},
+			Summary: "export the vault to an encrypted bundle (kpx) or a KeePass (KDBX 4) file",
+			Flags: []Flag{
+				{Name: "-o", Value: "file", Description: "the file to write, with 0600 permissions"},
+				{Name: "-recipient", Value: "public key", Description: "encrypt the bundle for this RSA key instead of a passphrase"},
+				{Name: "-plaintext", Description: "export unencrypted, see -format"},
+				{Name: "-format", Value: "csv|json|yaml", Description: "the -plaintext format (default json)"},
+				{Name: "-i-understand", Description: "skip the -plaintext confirmation"},
+				{Name: "-stdout", Description: "allow -plaintext to print to a terminal"},
+			},
+			Run: DoExport},
+		{Name: "merge", Args: []Arg{{Name: "other kpfile"}},
+			Summary: "merge the changes in another copy of the vault into this one",
+			Flags: []Flag{
+				{Name: "-key", Value: "private key", Description: "the key of the other vault (default KP_KEY)"},
+				{Name: "-strategy", Value: "ours|theirs|newest|both", Description: "for entries changed in both (asks if omitted)"},
+				{Name: "-dry-run", Description: "list what would change without saving"},
+			},
+			Run: DoMerge},
+		{Name: "diff", Args: []Arg{{Name: "a kpfile", Optional: true}, {Name: "b kpfile", Optional: true}},
+			Summary: "list the entries added, removed and changed from a to b (or the vault to a)",
+			Flags: []Flag{
+				{Name: "-at", Value: "rev", Description: "take a from the sync history at a git revision (e.g. HEAD~3)"},
+				{Name: "-key-a", Value: "private key", Description: "the key of vault a (default KP_KEY)"},
+				{Name: "-key-b", Value: "private key", Description: "the key of vault b (default KP_KEY)"},
+				{Name: "-reveal", Description: "show changed values in plaintext"},
+			},
+			Run: DoDiff},
+		{Name: "sync", Args: []Arg{{Name: "init", Optional: true}, {Name: "remote", Optional: true}},
+			Summary: "commit, merge and push the vault through a git remote",
+			Flags: []Flag{
+				{Name: "-strategy", Value: "ours|theirs|newest|both", Description: "for entries changed on both sides (asks if omitted)"},
+			},
+			Run: DoSync},
+		{Name: "rename", Args: []Arg{{Name: "key1"}, {Name: "key2"}},
+			Summary: "rename \"key1\" to \"key2\"",
+			Run:     DoRename},
+		{Name: "rm", Args: []Arg{{Name: "key"}},
+			Summary: "permanently remove \"key\"",
+			Run:     DoDelete},
+		{Name: "encrypt", Args: []Arg{{Name: "value"}},
+			Summary: "encrypt the value",
+			Run:     DoEncrypt},
+		{Name: "decrypt", Args: []Arg{{Name: "value"}},
+			Summary: "decrypt the value",
+			Run:     DoDecrypt},
+		{Name: "random", Args: []Arg{{Name: "size", Optional: true}},
+			Summary: "create a random password (64 characters by default)",
+			Flags: append([]Flag{
+				{Name: "-policy", Value: "policy", Description: "a named policy such as alnum, pin or strict (see kp policies)"},
+				{Name: "-length", Value: "size", Description: "the length (the size argument works too)"},
+				{Name: "-no-upper", Description: "no upper case letters"},
+				{Name: "-no-lower", Description: "no lower case letters"},
+				{Name: "-no-digits", Description: "no digits"},
+				{Name: "-no-symbols", Description: "no symbols"},
+				{Name: "-symbols", Value: "chars", Description: "the symbols to use, e.g. '!#-_'"},
+				{Name: "-no-ambiguous", Description: "leave out characters that look alike (" + AMBIGUOUS_CHARS + ")"},
+				{Name: "-min", Value: "count", Description: "at least this many of each class used"},
+				{Name: "-words", Value: "count", Description: "a diceware passphrase of N words from the EFF wordlist instead", OptionalValue: true},
+			}, passphraseFlags...),
+			NoVerify: true,
+			Run:      DoRandom},
+		{Name: "policies",
+			Summary:  "list the password policies, built in and from KP_CONFIG",
+			NoVerify: true,
+			Run:      DoPolicies},
+		{Name: "tag", Args: []Arg{{Name: "key or namespace"}, {Name: "tag"}},
+			Summary: "add tag to a key, or every key under a namespace/",
+			Run:     DoTag},
+		{Name: "untag", Args: []Arg{{Name: "key or namespace"}, {Name: "tag"}},
+			Summary: "remove tag from a key, or every key under a namespace/",
+			Run:     DoUntag},
+		{Name: "tags", Args: []Arg{{Name: "rename|rm", Optional: true}, {Name: "tag", Optional: true}, {Name: "new tag", Optional: true}},
+			Summary: "list tags with counts, or rename or remove a tag on every key",
+			Run:     DoTags},
+		{Name: "hide", Args: []Arg{{Name: "key or namespace"}},
+			Summary: "archive (hide) the key, or every key under a namespace/",
+			Run:     DoHide},
+		{Name: "show", Args: []Arg{{Name: "key or namespace"}},
+			Summary: "unarchive (make visible) the key, or every key under a namespace/",
+			Run:     DoShow},
+		{Name: "grep", Args: []Arg{{Name: "pattern"}},
+			Summary: "find the keys whose notes, description, username or url (or value) match",
+			Flags: []Flag{
+				{Name: "-values", Description: "decrypt and search the values too"},
+				{Name: "-reveal", Description: "print the matching lines (of values too)"},
+				{Name: "-regex", Description: "the pattern is a regular expression"},
+				{Name: "-i", Description: "ignore case"},
+				{Name: "-a", Description: "include hidden keys"},
+			},
+			Run: DoGrep},
+		{Name: "tree", Args: []Arg{{Name: "namespace", Optional: true}},
+			Summary: "draw the keys as a tree of namespaces (work/aws/prod/root)",
+			Flags:   []Flag{{Name: "-a", Description: "include hidden keys"}},
+			Run:     DoTree},
+		{Name: "mv", Args: []Arg{{Name: "key or namespace"}, {Name: "new key or namespace"}},
+			Summary: "rename a key, or move every key under a namespace/ to another",
+			Run:     DoMove},
+		{Name: "completion", Args: []Arg{{Name: "bash|zsh|fish"}},
+			Summary:  "print a shell completion script",
+			NoVerify: true,
+			Run:      DoCompletion},
+		{Name: "help", Args: []Arg{{Name: "command", Optional: true}},
+			Summary:  "print usage, or the help for a command",
+			NoVerify: true,
+			Run:      DoHelp},
+		{Name: "audit",
+			Summary: "flag weak, reused and old values, most urgent first; exits 1 when there are findings",
+			Flags: []Flag{
+				{Name: "-min-entropy", Value: "bits", Description: "flag values weaker than this (default 60)"},
+				{Name: "-days", Value: "days", Description: "flag values unchanged for longer (default 365)"},
+				{Name: "-breach", Value: "path", Description: "look values up in a downloaded HIBP SHA-1 file or range directory"},
+				{Name: "-fail-on", Value: "high|medium|low", Description: "the least urgent finding that fails the audit (default low)"},
+				{Name: "-a", Description: "include hidden keys"},
+			},
+			Run: DoAudit},
+		{Name: "due",
+			Summary: "list the entries overdue for rotation or due soon",
+			Flags: []Flag{
+				{Name: "-days", Value: "days", Description: "how far ahead to look (default 14)"},
+				{Name: "-a", Description: "include hidden keys"},
+			},
+			Run: DoDue},
+		{Name: "rotation", Args: []Arg{{Name: "set|rm", Optional: true}, {Name: "key or type:name or tag:name", Optional: true}, {Name: "days", Optional: true}},
+			Summary: "list, set or remove how often a key, type or tag should be changed",
+			Run:     DoRotation},
+		{Name: "stats",
+			Summary: "entry counts by type, tag and age, missing urls and usernames, and the largest values",
+			Run:     DoStats},
+		{Name: "info",
+			Summary:  "review environment variables used",
+			NoVerify: true,
+			Run:      DoInfo},
+		{Name: "verify",
+			Summary:  "check encryption keys exist and work",
+			NoVerify: true,
+			Run:      DoVerifyCommand},
+		{Name: "version",
+			Summary:  "print application version",
+			NoVerify: true,
+			Run:      DoVersion},
+	}
+}
+
+// FindCommand returns the registered command for a name or alias, or nil
+func FindCommand(name string) *Command {
+	for _, command := range COMMANDS {
+		if command.Name == name {
+			return command
+		}
+		for _, alias := range command.Aliases {
+			if alias == name {
+				return command
+			}
+		}
+	}
+	return nil
+}
+
+// FindFlag returns the flag of the command (or a global flag) matching name
+func (cmd *Command) FindFlag(name string) *Flag {
+	for _, flags := range [][]Flag{cmd.Flags, GLOBAL_FLAGS} {
+		for index := range flags {
+			if flags[index].Name == name {
+				return &flags[index]
+			}
+			for _, alias := range flags[index].Aliases {
+				if alias == name {
+					return &flags[index]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isFlag indicates an argument is meant as a flag rather than a value
+func isFlag(arg string) bool {
+	return len(arg) > 1 && strings.HasPrefix(arg, "-") && !strings.Contains(arg, " ")
+}
+
+// parseArgs splits the arguments after the command into positionals and the
+// flags that were used, consuming the value of any flag that takes one
+func (cmd *Command) parseArgs(args []string) ([]string, []string) {
+	flags := make([]string, 0)
+	positionals := cmd.scanArgs(args, func(index int, flag string) { flags = append(flags, flag) })
+	return positionals, flags
+}
+
+// scanArgs calls found with the index and name of each flag in args and
+// returns the positionals. A flag that takes a value always consumes the
+// next argument, so a value can start with "-" (-value -abc); one whose
+// value is optional only takes it when it does not look like a flag.
+func (cmd *Command) scanArgs(args []string, found func(index int, flag string)) []string {
+	positionals := make([]string, 0)
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		if !isFlag(arg) {
+			positionals = append(positionals, arg)
+			continue
+		}
+		found(index, arg)
+		flag := cmd.FindFlag(arg)
+		if flag == nil || flag.Value == "" || index+1 >= len(args) {
+			continue
+		}
+		if !flag.OptionalValue || !isFlag(args[index+1]) {
+			index++
+		}
+	}
+	return positionals
+}
+
+// flagAt is the index in c.Args of the flag (or one of its aliases), read
+// the way the command parses its arguments so a value that looks like a
+// flag is not taken for one; -1 when it is not given
+func flagAt(c *cli.CLI, name string) int {
+	cmd := FindCommand(c.GetCommand())
+	if cmd == nil || len(c.Args) == 0 {
+		return c.IndexOf(name)
+	}
+	want := name
+	if flag := cmd.FindFlag(name); flag != nil {
+		want = flag.Name
+	}
+	at := -1
+	cmd.scanArgs(c.Args[1:], func(index int, arg string) {
+		if flag := cmd.FindFlag(arg); at < 0 && (arg == name || (flag != nil && flag.Name == want)) {
+			at = index + 1
+		}
+	})
+	return at
+}
+
+// HasFlag indicates the flag was given
+func HasFlag(c *cli.CLI, name string) bool {
+	return flagAt(c, name) >= 0
+}
+
+// FlagString is the value given to a flag, even one starting with "-", or
+// defaultValue when the flag (or its optional value) is left out
+func FlagString(c *cli.CLI, name string, defaultValue string) string {
+	cmd := FindCommand(c.GetCommand())
+	if cmd == nil || cmd.FindFlag(name) == nil {
+		return c.GetStringOrDefault(name, defaultValue)
+	}
+	index := flagAt(c, name)
+	if index < 0 || index+1 >= len(c.Args) {
+		return defaultValue
+	}
+	value := c.Args[index+1]
+	if cmd.FindFlag(name).OptionalValue && isFlag(value) {
+		return defaultValue
+	}
+	return value
+}
+
+// FlagInt is the number given to a flag, or defaultValue when it is left
+// out; anything but a number is an error
+func FlagInt(c *cli.CLI, name string, defaultValue int) int {
+	value := FlagString(c, name, "")
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Error, %v should be a number.\n", name)
+		os.Exit(1)
+	}
+	return number
+}
+
+// Positionals returns the arguments to the current command that are not
+// flags or flag values
+func Positionals(c *cli.CLI) []string {
+	cmd := FindCommand(c.GetCommand())
+	if cmd == nil || len(c.Args) == 0 {
+		return []string{}
+	}
+	positionals, _ := cmd.parseArgs(c.Args[1:])
+	return positionals
+}
+
+// Validate checks the flags used are ones the command accepts and that the
+// required arguments are present
+func (cmd *Command) Validate(c *cli.CLI) error {
+	positionals, flags := cmd.parseArgs(c.Args[1:])
+	for _, flag := range flags {
+		if cmd.FindFlag(flag) != nil {
+			continue
+		}
+		message := fmt.Sprintf("kp %v: unknown flag '%v'", cmd.Name, flag)
+		suggestion := Suggest(flag, cmd.flagNames())
+		if suggestion != "" {
+			message += fmt.Sprintf(", did you mean '%v'?", suggestion)
+		}
+		return fmt.Errorf("%v\nRun 'kp help %v' for usage.", message, cmd.Name)
+	}
+	required := 0
+	for _, arg := range cmd.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+	if len(positionals) < required {
+		missing := cmd.Args[len(positionals)]
+		return fmt.Errorf("kp %v: <%v> is required\nRun 'kp help %v' for usage.", cmd.Name, missing.Name, cmd.Name)
+	}
+	return nil
+}
+
+func (cmd *Command) flagNames() []string {
+	names := make([]string, 0)
+	for _, flags := range [][]Flag{cmd.Flags, GLOBAL_FLAGS} {
+		for _, flag := range flags {
+			names = append(names, flag.Name)
+		}
+	}
+	return names
+}
+
+// Signature is the command as it is typed, e.g. "rename <key1> <key2>"
+func (cmd *Command) Signature() string {
+	parts := []string{cmd.Name}
+	for _, arg := range cmd.Args {
+		if arg.Optional {
+			parts = append(parts, "["+arg.Name+"]")
+		} else {
+			parts = append(parts, "<"+arg.Name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Signature is the flag as it is typed, e.g. "-url <url>"
+func (f Flag) Signature() string {
+	if f.Value == "" {
+		return f.Name
+	}
+	if f.OptionalValue {
+		return fmt.Sprintf("%v [%v]", f.Name, f.Value)
+	}
+	return fmt.Sprintf("%v <%v>", f.Name, f.Value)
+}
+
+// usageLine lays out a name and description in two columns
+func usageLine(indent int, name string, description string) string {
+	line := strings.Repeat(" ", indent) + name
+	if len(line) < USAGE_COLUMN {
+		line += strings.Repeat(" ", USAGE_COLUMN-len(line))
+	} else {
+		line += " "
+	}
+	return strings.TrimRight(line+description, " ") + "\n"
+}
+
+// USAGE_COLUMN is where descriptions start in the usage text
+const USAGE_COLUMN = 36
+
+// Usage generates the global usage text from the registry
+func Usage() string {
+	var sb strings.Builder
+	sb.WriteString(USAGE_HEADER)
+	for _, cmd := range COMMANDS {
+		sb.WriteString(usageLine(4, cmd.Signature(), cmd.Summary))
+		for _, flag := range cmd.Flags {
+			sb.WriteString(usageLine(9, flag.Signature(), flag.Description))
+		}
+		if len(cmd.Flags) > 0 {
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("\nThe global options are:\n\n")
+	for _, flag := range GLOBAL_FLAGS {
+		sb.WriteString(usageLine(4, flag.Signature(), flag.Description))
+	}
+	sb.WriteString("\nRun 'kp help <command>' for more about a command.\n\n")
+	return sb.String()
+}
+
+// CommandUsage generates the help for a single command
+func CommandUsage(cmd *Command) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Usage: kp %v", cmd.Signature()))
+	if len(cmd.Flags) > 0 {
+		sb.WriteString(" [flags]")
+	}
+	sb.WriteString(fmt.Sprintf("\n\n%v\n", cmd.Summary))
+	if len(cmd.Aliases) > 0 {
+		sb.WriteString(fmt.Sprintf("\nAliases: %v\n", strings.Join(cmd.Aliases, ", ")))
+	}
+	if len(cmd.Flags) > 0 {
+		sb.WriteString("\nFlags:\n\n")
+		for _, flag := range cmd.Flags {
+			name := flag.Signature()
+			if len(flag.Aliases) > 0 {
+				name += " (" + strings.Join(flag.Aliases, ", ") + ")"
+			}
+			sb.WriteString(usageLine(4, name, flag.Description))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// DoHelp prints the usage, or the help for one command
+func DoHelp(c *cli.CLI) {
+	positionals := Positionals(c)
+	if len(positionals) == 0 {
+		DoLogo()
+		DoUsage(c)
+		return
+	}
+	cmd := FindCommand(positionals[0])
+	if cmd == nil {
+		FailUnknownCommand(c, positionals[0])
+	}
+	fmt.Print(CommandUsage(cmd))
+}
+
+// FailUnknownCommand reports a command that is not in the registry
+func FailUnknownCommand(c *cli.CLI, name string) {
+	names := make([]string, 0)
+	for _, cmd := range COMMANDS {
+		names = append(names, cmd.Name)
+		names = append(names, cmd.Aliases...)
+	}
+	message := fmt.Sprintf("kp %v: unknown command", name)
+	suggestion := Suggest(name, names)
+	if suggestion != "" {
+		message += fmt.Sprintf(", did you mean '%v'?", suggestion)
+	}
+	Fail(c, ERR_UNKNOWN, "%v\nRun 'kp help' for usage.", message)
+}
+
+// Suggest returns the candidate closest to value, or "" if none is close
+func Suggest(value string, candidates []string) string {
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+	best := ""
+	bestDistance := 3 // anything further away is not a typo
+	for _, candidate := range sorted {
+		distance := levenshtein(strings.TrimLeft(value, "-"), strings.TrimLeft(candidate, "-"))
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// RunCommand validates and runs a command from the registry, verifying the
+// encryption keys first unless the command does not need them
+func RunCommand(c *cli.CLI) {
+	name := c.GetCommand()
+	cmd := FindCommand(name)
+	if cmd == nil {
+		FailUnknownCommand(c, name)
+	}
+	if HasFlag(c, "-h") || HasFlag(c, "-help") {
+		fmt.Print(CommandUsage(cmd))
+		return
+	}
+	err := cmd.Validate(c)
+	if err != nil {
+		Fail(c, ERR_USAGE, "%v", err)
+	}
+	if !cmd.NoVerify {
+		VerifyOrDie(c)
+	}
+	cmd.Run(c)
+}
+
+// VerifyOrDie exits with instructions when the encryption keys do not work
+func VerifyOrDie(c *cli.CLI) {
+	result := DoVerify(c, false)
+	if !result && IsJSON(c) {
+		Fail(c, ERR_NOT_CONFIGURED, "Failed to verify encryption, run 'kp verify' for details.")
+	} else if !result {
+		fmt.Println("Failed to verify encryption.")
+		fmt.Println("")
+		fmt.Println("Run 'kp verify' for details, or create an encryption key with:")
+		fmt.Println("")
+		keyFile := os.Getenv(KP_KEY)
+		if keyFile == "" {
+			keyFile = DEFAULT_KEY_FILE
+		}
+		fmt.Printf("    %v\n", GetSSHCommand(keyFile))
+		fmt.Println("")
+		os.Exit(1)
+	}
+}
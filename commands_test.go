@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	cli "github.com/simonski/cli"
+)
+
+func TestValidateFlags(t *testing.T) {
+	c := cli.New([]string{"update", "mykey", "-notes", "some notes", "-url", "https://example.com"})
+	if err := FindCommand("update").Validate(c); err != nil {
+		t.Fatalf("expected valid, got %v", err)
+	}
+
+	c = cli.New([]string{"update", "mykey", "-note", "alias still works"})
+	if err := FindCommand("update").Validate(c); err != nil {
+		t.Fatalf("expected alias to be valid, got %v", err)
+	}
+
+	c = cli.New([]string{"get", "mykey", "-stdot"})
+	err := FindCommand("get").Validate(c)
+	if err == nil || !strings.Contains(err.Error(), "did you mean '-stdout'?") {
+		t.Fatalf("expected a suggestion, got %v", err)
+	}
+
+	c = cli.New([]string{"rename", "mykey"})
+	err = FindCommand("rename").Validate(c)
+	if err == nil || !strings.Contains(err.Error(), "<key2> is required") {
+		t.Fatalf("expected missing argument, got %v", err)
+	}
+}
+
+func TestPositionals(t *testing.T) {
+	c := cli.New([]string{"ls", "-a", "widget"})
+	positionals := Positionals(c)
+	if len(positionals) != 1 || positionals[0] != "widget" {
+		t.Fatalf("expected [widget], got %v", positionals)
+	}
+}
+
+func TestUsageListsEveryCommand(t *testing.T) {
+	usage := Usage()
+	for _, cmd := range COMMANDS {
+		if !strings.Contains(usage, "    "+cmd.Signature()) {
+			t.Errorf("usage is missing %v", cmd.Name)
+		}
+	}
+}
+
+func TestFlagValuesStartingWithDash(t *testing.T) {
+	c := cli.New([]string{"put", "k", "-value", "-abc", "-note", "-a"})
+	if err := FindCommand("put").Validate(c); err != nil {
+		t.Fatalf("expected a dash value to be valid, got %v", err)
+	}
+	if value := FlagString(c, "-value", ""); value != "-abc" {
+		t.Fatalf("expected -abc, got %q", value)
+	}
+	if notes := FlagString(c, "-notes", ""); notes != "-a" || HasFlag(c, "-a") {
+		t.Fatalf("expected the alias to read -a as its value, got %q", notes)
+	}
+
+	c = cli.New([]string{"random", "-symbols", "-_", "-no-digits"})
+	if FlagString(c, "-symbols", "") != "-_" || !HasFlag(c, "-no-digits") {
+		t.Fatalf("expected -symbols -_ and -no-digits")
+	}
+
+	c = cli.New([]string{"random", "-words", "4", "-sep", "-"})
+	if FlagInt(c, "-words", 0) != 4 || FlagString(c, "-sep", "") != "-" {
+		t.Fatalf("expected -words 4 -sep -")
+	}
+	c = cli.New([]string{"put", "k", "-passphrase", "-sep", "-", "-capitalize", "-number"})
+	if err := FindCommand("put").Validate(c); err != nil {
+		t.Fatalf("expected the passphrase flags on put, got %v", err)
+	}
+	if FlagString(c, "-sep", "") != "-" || !HasFlag(c, "-capitalize") || !HasFlag(c, "-number") {
+		t.Fatalf("expected -sep - -capitalize -number")
+	}
+
+	// an optional value is left out when a flag follows
+	c = cli.New([]string{"put", "k", "-random", "-type", "login"})
+	if FlagInt(c, "-random", 0) != 0 || FlagString(c, "-type", "") != "login" {
+		t.Fatalf("expected -random without a size")
+	}
+	if positionals := Positionals(c); len(positionals) != 1 || positionals[0] != "k" {
+		t.Fatalf("expected [k], got %v", positionals)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	cli "github.com/simonski/cli"
+)
+
+// COMPLETE_COMMAND is the hidden command the shell scripts call back into
+const COMPLETE_COMMAND = "__complete"
+
+const BASH_COMPLETION = `# kp bash completion, install with:
+#     source <(kp completion bash)
+_kp_complete() {
+    local IFS=$'\n'
+    COMPREPLY=( $(kp __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null) )
+}
+complete -o default -F _kp_complete kp
+`
+
+const ZSH_COMPLETION = `#compdef kp
+# kp zsh completion, install with:
+#     source <(kp completion zsh)
+_kp() {
+    local -a candidates
+    candidates=("${(@f)$(kp __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    compadd -a candidates
+}
+compdef _kp kp
+`
+
+const FISH_COMPLETION = `# kp fish completion, install with:
+#     kp completion fish | source
+function __kp_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    kp __complete $tokens[2..-1] "$current" 2>/dev/null
+end
+complete -c kp -f -a '(__kp_complete)'
+`
+
+// Complete returns the candidates for the last of words, which are the
+// arguments typed after "kp" (the last may be empty). Keys and tags are read
+// from the vault without decrypting anything.
+func Complete(db *KPDB, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	candidates := make([]string, 0)
+
+	if len(words) == 1 {
+		for _, command := range COMMANDS {
+			candidates = append(candidates, command.Name)
+		}
+		return filterPrefix(candidates, current)
+	}
+
+	command := FindCommand(words[0])
+	if command == nil {
+		return candidates
+	}
+
+	if strings.HasPrefix(current, "-") {
+		candidates = append(candidates, command.flagNames()...)
+		return filterPrefix(candidates, current)
+	}
+
+	previous := words[len(words)-2]
+	flag := command.FindFlag(previous)
+	if flag != nil && flag.Value != "" {
+		// completing the value of a flag, leave it to the shell
+		return candidates
+	}
+
+	positionals, _ := command.parseArgs(words[1 : len(words)-1])
+	position := len(positionals)
+	if position >= len(command.Args) {
+		return candidates
+	}
+
+	arg := command.Args[position].Name
+	if strings.HasSuffix(arg, "namespace") {
+		candidates = append(candidates, CompletionNamespaces(db)...)
+	}
+	if strings.HasPrefix(arg, "key") {
+		candidates = append(candidates, CompletionKeys(db)...)
+	} else if arg == "tag" {
+		candidates = append(candidates, CompletionTags(db)...)
+	} else if arg == "command" {
+		for _, command := range COMMANDS {
+			candidates = append(candidates, command.Name)
+		}
+	} else if strings.Contains(arg, "|") {
+		candidates = append(candidates, strings.Split(arg, "|")...)
+	}
+	return filterPrefix(candidates, current)
+}
+
+// CompletionKeys lists every key in the vault, sorted
+func CompletionKeys(db *KPDB) []string {
+	keys := make([]string, 0)
+	for key := range db.GetData().Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CompletionNamespaces lists every namespace (work/, work/aws/, ...), sorted
+func CompletionNamespaces(db *KPDB) []string {
+	seen := make(map[string]bool)
+	namespaces := make([]string, 0)
+	for key := range db.GetData().Entries {
+		parts := strings.Split(key, NAMESPACE_SEPARATOR)
+		for i := 1; i < len(parts); i++ {
+			namespace := strings.Join(parts[:i], NAMESPACE_SEPARATOR) + NAMESPACE_SEPARATOR
+			if !seen[namespace] {
+				seen[namespace] = true
+				namespaces = append(namespaces, namespace)
+			}
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// CompletionTags lists every tag used in the vault, sorted
+func CompletionTags(db *KPDB) []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, entry := range db.GetData().Entries {
+		for _, tag := range entry.TagList() {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	result := make([]string, 0)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
+
+// DoComplete is the hidden command used by the completion scripts; it prints
+// one candidate per line
+func DoComplete(c *cli.CLI) {
+	db := LoadDB()
+	for _, candidate := range Complete(db, c.Args[1:]) {
+		fmt.Println(candidate)
+	}
+}
+
+// DoCompletion prints the completion script for a shell
+func DoCompletion(c *cli.CLI) {
+	command := c.GetCommand()
+	shell := c.GetStringOrDefault(command, "")
+	switch shell {
+	case "bash":
+		fmt.Print(BASH_COMPLETION)
+	case "zsh":
+		fmt.Print(ZSH_COMPLETION)
+	case "fish":
+		fmt.Print(FISH_COMPLETION)
+	default:
+		fmt.Print("Usage: kp completion <bash|zsh|fish>\n")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	db := newTestDB(t)
+	db.GetData().Entries["work/aws"] = DBEntry{Key: "work/aws", Tags: map[string]bool{"prod": true}}
+	db.GetData().Entries["work/gcp"] = DBEntry{Key: "work/gcp", Tags: map[string]bool{"dev": true}}
+	db.GetData().Entries["home/wifi"] = DBEntry{Key: "home/wifi"}
+
+	cases := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{"ver"}, []string{"verify", "version"}},
+		{[]string{"get", "work/"}, []string{"work/aws", "work/gcp"}},
+		{[]string{"tag", "home/wifi", ""}, []string{"dev", "prod"}},
+		{[]string{"get", "-st"}, []string{"-stdout"}},
+		{[]string{"completion", "z"}, []string{"zsh"}},
+		{[]string{"rename", "home/wifi", "work/aws", ""}, []string{}},
+	}
+	for _, tc := range cases {
+		actual := Complete(db, tc.words)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("Complete(%q) = %q, expected %q", tc.words, actual, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// KP_CONFIG the key for the env var pointing to the (optional) config file
+const KP_CONFIG = "KP_CONFIG"
+
+const DEFAULT_CONFIG_FILE = "~/.kpconfig"
+
+// Config is the settings kp reads from KP_CONFIG, a JSON file such as
+//
+//	{"policies": {"bank": {"length": 12, "lower": true, "digits": true}}}
+type Config struct {
+	Policies map[string]PasswordPolicy `json:"policies"`
+}
+
+// LoadConfig reads the config file; it is fine for there to be none
+func LoadConfig() (*Config, error) {
+	filename := goutils.EvaluateFilename(cli.GetEnvOrDefault(KP_CONFIG, DEFAULT_CONFIG_FILE))
+	config := &Config{Policies: make(map[string]PasswordPolicy)}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("cannot read %v: %v", filename, err)
+	}
+	if config.Policies == nil {
+		config.Policies = make(map[string]PasswordPolicy)
+	}
+	return config, nil
+}
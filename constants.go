@@ -11,8 +11,9 @@ const KP_KEY = "KP_KEY"
 const DEFAULT_KEY_FILE = "~/.ssh/kp.id_rsa"
 const DEFAULT_DB_FILE = "~/.kpfile"
 
-// GLOBAL_USAGE - well, it tells me what to type
-const GLOBAL_USAGE = `kp is a tool for using key/pairs.
+// USAGE_HEADER - well, it tells me what to type; the commands are listed
+// after it from the registry
+const USAGE_HEADER = `kp is a tool for using key/pairs.
 
 Usage:
 
@@ -20,44 +21,6 @@ Usage:
 
 The commands are:
 
-    ls  <search term>               list keys 
-         -a (include hidden)
-
-    put <key>                       save "key/value" (read stdin for value), or:
-                                      -value           (if specified avoids reading stdin) 
-                                      -default <value> (if specified then used when no value is entered)
-                                      -random <size>   (if specified then a N-character random string is used)
-
-    get <key>                       retrieve key/value to clipboard
-                                      -stdout - writes directly to stdout 
-
-    update <key>                    update metadata on the key
-         -description                   
-         -type
-         -url
-         -username
-         -note
-
-    open <key>                      opens the url associated with the key 
-
-    rename <key1> <key2>            rename "key1" to "key2"
-    rm <key>                        permanently remove "key"
-
-    encrypt <value>                 encrypt the value 
-    decrypt <value>                 decrypt the value
-
-    random <size>                   create a 64-character random string
-
-    tag   <key> <tag>               add tag to a key
-    untag <key> <tag>               remove tag from a key
-
-    hide <key>                      archive (hide) the key
-    show <key>                      unarchive (make visible) the key
-
-    info                            review environment variables used
-    verify                          check encryption keys exist and work
-    version                         print application version
-
 `
 
 const GLOBAL_SSH_KEYGEN_USAGE = `The following will create a suitable encryption key: 
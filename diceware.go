@@ -0,0 +1,102 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	cli "github.com/simonski/cli"
+)
+
+// DEFAULT_PASSPHRASE_SEPARATOR goes between the words unless -sep is given
+const DEFAULT_PASSPHRASE_SEPARATOR = " "
+
+// DEFAULT_PASSPHRASE_WORDS is how many words a passphrase has by default
+// (about 77 bits of entropy)
+const DEFAULT_PASSPHRASE_WORDS = 6
+
+// the EFF large wordlist, 7776 words each numbered by five dice rolls:
+// https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var (
+	wordlist     []string
+	wordlistOnce sync.Once
+)
+
+// Wordlist is the words passphrases are made from
+func Wordlist() []string {
+	wordlistOnce.Do(func() {
+		for _, line := range strings.Split(strings.TrimSpace(effLargeWordlist), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				wordlist = append(wordlist, fields[1])
+			}
+		}
+	})
+	return wordlist
+}
+
+// PassphraseOptions is how a diceware passphrase is made
+type PassphraseOptions struct {
+	Words      int
+	Separator  string
+	Capitalize bool // Upper case the first letter of each word
+	Number     bool // add a digit to the end of one of the words
+}
+
+// GeneratePassphrase picks words at random from the wordlist, returning the
+// passphrase and its entropy in bits
+func GeneratePassphrase(options PassphraseOptions) (string, float64, error) {
+	if options.Words <= 0 {
+		return "", 0, fmt.Errorf("a passphrase needs at least 1 word")
+	}
+	words := make([]string, options.Words)
+	for i := range words {
+		index, err := randomInt(len(Wordlist()))
+		if err != nil {
+			return "", 0, err
+		}
+		words[i] = Wordlist()[index]
+		if options.Capitalize {
+			first, size := utf8.DecodeRuneInString(words[i])
+			words[i] = string(unicode.ToUpper(first)) + words[i][size:]
+		}
+	}
+	entropy := float64(options.Words) * math.Log2(float64(len(Wordlist())))
+	if options.Number {
+		word, err := randomInt(len(words))
+		if err != nil {
+			return "", 0, err
+		}
+		digit, err := randomInt(10)
+		if err != nil {
+			return "", 0, err
+		}
+		words[word] += fmt.Sprint(digit)
+		entropy += math.Log2(float64(10 * len(words)))
+	}
+	return strings.Join(words, options.Separator), entropy, nil
+}
+
+// GeneratePassphraseFromFlags makes a passphrase of the given number of
+// words with -sep, -capitalize and -number, or exits with the error
+func GeneratePassphraseFromFlags(c *cli.CLI, words int) (string, float64) {
+	passphrase, entropy, err := GeneratePassphrase(PassphraseOptions{
+		Words:      words,
+		Separator:  FlagString(c, "-sep", DEFAULT_PASSPHRASE_SEPARATOR),
+		Capitalize: HasFlag(c, "-capitalize"),
+		Number:     HasFlag(c, "-number"),
+	})
+	if err != nil {
+		fmt.Printf("Error, %v.\n", err)
+		os.Exit(1)
+	}
+	return passphrase, entropy
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWordlist(t *testing.T) {
+	words := Wordlist()
+	if len(words) != 7776 || words[0] != "abacus" || words[7775] != "zoom" {
+		t.Fatalf("unexpected wordlist of %v words", len(words))
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	passphrase, entropy, err := GeneratePassphrase(PassphraseOptions{Words: 6, Separator: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Split(passphrase, "-")) < 6 || math.Abs(entropy-77.55) > 0.01 {
+		t.Fatalf("unexpected passphrase %q with %v bits", passphrase, entropy)
+	}
+
+	passphrase, _, _ = GeneratePassphrase(PassphraseOptions{Words: 4, Separator: " ", Capitalize: true, Number: true})
+	words := strings.Split(passphrase, " ")
+	digits := 0
+	for _, word := range words {
+		if word[0] < 'A' || word[0] > 'Z' {
+			t.Fatalf("expected %q to be capitalized", word)
+		}
+		if strings.ContainsAny(word, DIGIT_CHARS) {
+			digits++
+		}
+	}
+	if len(words) != 4 || digits != 1 {
+		t.Fatalf("expected 4 words, one with a digit, got %q", passphrase)
+	}
+
+	if _, _, err := GeneratePassphrase(PassphraseOptions{Words: 0}); err == nil {
+		t.Fatalf("expected 0 words to fail")
+	}
+}
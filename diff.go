@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// EntryDiff is a key in both vaults whose entry differs; the values are only
+// filled in when revealed. When a value cannot be decrypted, whether it
+// changed is unknown and the entry is listed as undecryptable.
+type EntryDiff struct {
+	Key           string   `json:"key"`
+	Fields        []string `json:"fields"`
+	From          *string  `json:"from,omitempty"`
+	To            *string  `json:"to,omitempty"`
+	Undecryptable bool     `json:"undecryptable,omitempty"`
+}
+
+// VaultDiff is what changes going from vault a to vault b
+type VaultDiff struct {
+	Added   []string    `json:"added"`
+	Removed []string    `json:"removed"`
+	Changed []EntryDiff `json:"changed"`
+}
+
+// DiffVaults compares two vaults by key. Values are decrypted to be compared
+// (the same value encrypts differently every time); when either side cannot
+// be, the rest of the entry is compared and it is listed as undecryptable.
+// Values are only included when reveal is set.
+func DiffVaults(a *KPDB, b *KPDB, reveal bool) VaultDiff {
+	diff := VaultDiff{Added: make([]string, 0), Removed: make([]string, 0), Changed: make([]EntryDiff, 0)}
+	for key := range a.GetData().Entries {
+		if _, exists := b.GetData().Entries[key]; !exists {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	for _, to := range b.GetEntriesSortedByUpdatedThenKey() {
+		from, exists := a.GetData().Entries[to.Key]
+		if !exists {
+			diff.Added = append(diff.Added, to.Key)
+			continue
+		}
+		fromValue, fromErr := a.Decrypt(from.Value)
+		toValue, toErr := b.Decrypt(to.Value)
+		decrypted := fromErr == nil && toErr == nil
+		from.Value, to.Value = fromValue, toValue
+		if !decrypted {
+			from.Value, to.Value = "", ""
+		}
+		fields := DiffFields(from, to)
+		if len(fields) == 0 && decrypted {
+			continue
+		}
+		change := EntryDiff{Key: to.Key, Fields: fields, Undecryptable: !decrypted}
+		if reveal && decrypted && contains(fields, "value") {
+			change.From, change.To = &fromValue, &toValue
+		}
+		diff.Changed = append(diff.Changed, change)
+	}
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+// Empty is true when the vaults hold the same entries
+func (d VaultDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Print writes the diff as "+ key", "- key" and "~ key (fields)" lines
+func (d VaultDiff) Print() {
+	if d.Empty() {
+		fmt.Printf("No differences.\n")
+		return
+	}
+	for _, key := range d.Added {
+		fmt.Printf("+ %v\n", key)
+	}
+	for _, key := range d.Removed {
+		fmt.Printf("- %v\n", key)
+	}
+	for _, change := range d.Changed {
+		fields := make([]string, 0)
+		for _, field := range change.Fields {
+			if field == "value" {
+				field = "value changed"
+			}
+			fields = append(fields, field)
+		}
+		if change.Undecryptable {
+			fields = append(fields, "value unknown, cannot decrypt")
+		}
+		fmt.Printf("~ %v (%v)\n", change.Key, strings.Join(fields, ", "))
+		if change.From != nil {
+			fmt.Printf("    - %v\n    + %v\n", *change.From, *change.To)
+		}
+	}
+	fmt.Printf("\n%v added, %v removed, %v changed.\n", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// DoDiff is "kp diff <a.kpfile> [b.kpfile]"; with one file it is compared
+// with the current vault. "-at <rev>" takes a from the sync history instead.
+func DoDiff(c *cli.CLI) {
+	positionals := Positionals(c)
+	defaultKey := cli.GetEnvOrDefault(KP_KEY, DEFAULT_KEY_FILE)
+	var a, b *KPDB
+	if HasFlag(c, "-at") {
+		dir := goutils.EvaluateFilename(cli.GetEnvOrDefault(KP_SYNC_DIR, DEFAULT_SYNC_DIR))
+		var err error
+		a, err = SyncedVault(dir, FlagString(c, "-at", ""), FlagString(c, "-key-a", defaultKey))
+		if err != nil {
+			Fail(c, ERR_NOT_FOUND, "Error, %v", err)
+		}
+		if len(positionals) > 0 {
+			b = loadDiffDB(c, positionals[0], FlagString(c, "-key-b", defaultKey))
+		} else {
+			b = LoadDB()
+		}
+	} else if len(positionals) == 0 {
+		Fail(c, ERR_USAGE, "Usage: kp diff <a.kpfile> [b.kpfile] (or -at <rev> [b.kpfile])")
+	} else if len(positionals) > 1 {
+		a = loadDiffDB(c, positionals[0], FlagString(c, "-key-a", defaultKey))
+		b = loadDiffDB(c, positionals[1], FlagString(c, "-key-b", defaultKey))
+	} else {
+		a = LoadDB()
+		b = loadDiffDB(c, positionals[0], FlagString(c, "-key-b", defaultKey))
+	}
+
+	diff := DiffVaults(a, b, HasFlag(c, "-reveal"))
+	if IsJSON(c) {
+		PrintJSON(c, diff)
+	} else {
+		diff.Print()
+	}
+}
+
+func loadDiffDB(c *cli.CLI, filename string, key string) *KPDB {
+	filename = goutils.EvaluateFilename(filename)
+	if _, err := os.Stat(filename); err != nil {
+		Fail(c, ERR_NOT_FOUND, "Error, %v does not exist.", filename)
+	}
+	return NewKPDB(filename, key)
+}
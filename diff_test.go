@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffVaults(t *testing.T) {
+	a := newTestDB(t)
+	b := NewKPDB(filepath.Join(t.TempDir(), "kpfile"), a.PrivateKeyFilename)
+	a.Put(DBEntry{Key: "same", Value: "1"})
+	b.Put(DBEntry{Key: "same", Value: "1"})
+	a.Put(DBEntry{Key: "removed", Value: "x"})
+	b.Put(DBEntry{Key: "added", Value: "x"})
+	a.Put(DBEntry{Key: "changed", Value: "old", Url: "a"})
+	b.Put(DBEntry{Key: "changed", Value: "new", Url: "b"})
+
+	diff := DiffVaults(a, b, false)
+	if len(diff.Added) != 1 || diff.Added[0] != "added" || len(diff.Removed) != 1 || diff.Removed[0] != "removed" {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Key != "changed" || len(diff.Changed[0].Fields) != 2 || diff.Changed[0].From != nil {
+		t.Fatalf("unexpected changes %+v", diff.Changed)
+	}
+
+	revealed := DiffVaults(a, b, true)
+	if change := revealed.Changed[0]; change.From == nil || *change.From != "old" || *change.To != "new" {
+		t.Fatalf("expected the values to be revealed, got %+v", change)
+	}
+}
+
+func TestDiffVaultsUndecryptable(t *testing.T) {
+	a := newTestDB(t)
+	b := NewKPDB(filepath.Join(t.TempDir(), "kpfile"), a.PrivateKeyFilename)
+	a.Put(DBEntry{Key: "same", Value: "1"})
+	b.Put(DBEntry{Key: "same", Value: "1"})
+	entry := b.GetData().Entries["same"]
+	entry.Value = "not a ciphertext"
+	b.GetData().Entries["same"] = entry
+
+	diff := DiffVaults(a, b, true)
+	if len(diff.Changed) != 1 || !diff.Changed[0].Undecryptable || len(diff.Changed[0].Fields) != 0 || diff.Changed[0].From != nil {
+		t.Fatalf("expected the entry to be listed as undecryptable, got %+v", diff.Changed)
+	}
+}
+
+func TestDiffSyncHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	db := newTestDB(t)
+	dir := filepath.Join(t.TempDir(), "sync")
+	if err := SyncInit(dir, remote); err != nil {
+		t.Fatal(err)
+	}
+	db.Put(DBEntry{Key: "a", Value: "1"})
+	if _, err := Sync(db, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	db.Put(DBEntry{Key: "a", Value: "2"})
+	db.Put(DBEntry{Key: "b", Value: "x"})
+	if _, err := Sync(db, dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := SyncedVault(dir, "HEAD~1", db.PrivateKeyFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffVaults(before, db, true)
+	if len(diff.Added) != 1 || diff.Added[0] != "b" || len(diff.Changed) != 1 || *diff.Changed[0].From != "1" || *diff.Changed[0].To != "2" {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if _, err := SyncedVault(dir, "HEAD~5", db.PrivateKeyFilename); err == nil {
+		t.Fatalf("expected an unknown revision to fail")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	cli "github.com/simonski/cli"
+	terminal "golang.org/x/term"
+)
+
+// EnvName turns a key into an environment variable name: "aws/prod-key"
+// becomes AWS_PROD_KEY
+func EnvName(key string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(key) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// ShellQuote quotes a value for a POSIX shell
+func ShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// EnvExports is an export line for each entry (values in plaintext); two
+// keys that make the same name are an error rather than one overwriting the
+// other
+func EnvExports(entries []DBEntry) ([]string, error) {
+	lines := make([]string, 0)
+	keys := make(map[string]string)
+	for _, entry := range entries {
+		name := EnvName(entry.Key)
+		if other, exists := keys[name]; exists {
+			return nil, fmt.Errorf("'%v' and '%v' are both %v, narrow the query", other, entry.Key, name)
+		}
+		keys[name] = entry.Key
+		lines = append(lines, fmt.Sprintf("export %v=%v", name, ShellQuote(entry.Value)))
+	}
+	return lines, nil
+}
+
+// DoEnv is "kp env [query]", an export line for every matching entry, so
+// eval "$(kp env tag:dev)" loads them into the shell. It is a plaintext
+// export and is guarded like one: it is confirmed (or -i-understand, which
+// every entry needs too), a terminal needs -stdout, and it is logged.
+func DoEnv(c *cli.CLI) {
+	text := strings.Join(Positionals(c), " ")
+	if text == "" && !HasFlag(c, "-i-understand") {
+		fmt.Printf("Error, refusing to export every secret, give a query (or -i-understand).\n")
+		os.Exit(1)
+	}
+	if terminal.IsTerminal(int(syscall.Stdout)) && !HasFlag(c, "-stdout") {
+		fmt.Printf("Error, refusing to print secrets to the terminal, use eval \"$(kp env <query>)\" (or -stdout).\n")
+		os.Exit(1)
+	}
+	query, err := ParseQuery(text, time.Now())
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	includeHidden := HasFlag(c, "-a") || query.Hidden
+
+	db := LoadDB()
+	entries := make([]DBEntry, 0)
+	for _, e := range db.GetEntriesSortedByUpdatedThenKey() {
+		if (!includeHidden && e.Hidden) || !query.Match(e) {
+			continue
+		}
+		entry, _ := db.GetDecrypted(e.Key)
+		entries = append(entries, entry)
+	}
+	lines, err := EnvExports(entries)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	if !HasFlag(c, "-i-understand") && !confirmPlaintext(len(entries), "") {
+		fmt.Fprintf(os.Stderr, "Export cancelled.\n")
+		os.Exit(1)
+	}
+	if err := LogEvent("export env query=%q entries=%v", text, len(entries)); err != nil {
+		fmt.Printf("Error, cannot log the export, nothing was written: %v\n", err)
+		os.Exit(1)
+	}
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
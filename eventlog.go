@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// KP_LOG the key for the env var pointing to the log of sensitive events
+// (plaintext exports and the like)
+const KP_LOG = "KP_LOG"
+
+const DEFAULT_LOG_FILE = "~/.kp.log"
+
+// LogEvent appends a timestamped line, with the user and host, to the event
+// log; the log is created with 0600 permissions
+func LogEvent(format string, args ...interface{}) error {
+	filename := goutils.EvaluateFilename(cli.GetEnvOrDefault(KP_LOG, DEFAULT_LOG_FILE))
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	host, _ := os.Hostname()
+	_, err = fmt.Fprintf(file, "%v %v@%v %v\n", time.Now().UTC().Format(time.RFC3339), username, host, fmt.Sprintf(format, args...))
+	return err
+}
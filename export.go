@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	cli "github.com/simonski/cli"
+)
+
+// DecryptAll returns every entry (hidden ones too) with its value decrypted,
+// sorted by key
+func DecryptAll(db *KPDB) []DBEntry {
+	entries := make([]DBEntry, 0)
+	for _, e := range db.GetEntriesSortedByUpdatedThenKey() {
+		entry, _ := db.GetDecrypted(e.Key)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// DoExport is "kp export [kdbx|kpx] <file>" (or "-o <file>"); the format
+// defaults to a kp bundle. "-plaintext" exports without encryption.
+func DoExport(c *cli.CLI) {
+	format, filename := exportTarget(Positionals(c), FlagString(c, "-o", ""))
+	if HasFlag(c, "-plaintext") {
+		if format != BUNDLE_FORMAT {
+			fmt.Printf("Error, -plaintext takes -format, not '%v'.\n", format)
+			os.Exit(1)
+		}
+		DoExportPlaintext(c, filename)
+		return
+	}
+	if filename == "" {
+		fmt.Printf("Error, the file to export to is required.\n")
+		os.Exit(1)
+	}
+
+	switch format {
+	case BUNDLE_FORMAT:
+		DoExportBundle(c, filename)
+	case "kdbx":
+		password, err := ReadPassphrase("Master password", true)
+		if err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		db := LoadDB()
+		entries := DecryptAll(db)
+		err = WriteKDBXFile(filename, entries, password)
+		if err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Exported %v entries to %v.\n", len(entries), filename)
+	default:
+		fmt.Printf("Error, cannot export '%v', the formats are: kdbx, kpx\n", format)
+		os.Exit(1)
+	}
+}
+
+// exportTarget reads "[format] <file>" from the positionals, with -o as
+// the file when there is none
+func exportTarget(positionals []string, output string) (string, string) {
+	format, filename := BUNDLE_FORMAT, output
+	if len(positionals) > 1 {
+		format, filename = positionals[0], positionals[1]
+	} else if len(positionals) == 1 {
+		if contains([]string{"kdbx", BUNDLE_FORMAT}, positionals[0]) {
+			format = positionals[0]
+		} else {
+			filename = positionals[0]
+		}
+	}
+	return format, filename
+}
+
+// DoExportBundle writes the vault to a bundle, for -recipient or under a
+// passphrase
+func DoExportBundle(c *cli.CLI, filename string) {
+	var recipient *rsa.PublicKey
+	passphrase := ""
+	var err error
+	if HasFlag(c, "-recipient") {
+		recipient, err = LoadRecipientKey(FlagString(c, "-recipient", ""))
+	} else {
+		passphrase, err = ReadPassphrase("Bundle passphrase", true)
+	}
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := ExportBundle(LoadDB())
+	var bundle *Bundle
+	if err == nil {
+		bundle, err = SealBundle(data, passphrase, recipient)
+	}
+	if err == nil {
+		err = WriteBundleFile(filename, bundle)
+	}
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %v entries to %v.\n", len(data.Entries), filename)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fuzzy scoring: every matched character scores, with bonuses for runs of
+// consecutive characters and for a run starting a word, and a penalty for
+// each gap (and every character in it) between the matched characters
+const (
+	FUZZY_MATCH       = 16
+	FUZZY_CONSECUTIVE = 12
+	FUZZY_BOUNDARY    = 8
+	FUZZY_START       = 12
+	FUZZY_GAP_OPEN    = 5
+	FUZZY_GAP         = 1
+)
+
+// the terminal sequences matched characters are shown with (bold yellow)
+const (
+	HIGHLIGHT_ON  = "\x1b[1;33m"
+	HIGHLIGHT_OFF = "\x1b[0m"
+)
+
+// SEARCH_FIELDS are the fields kp ls searches, and how much a match in each
+// counts; a key match outranks everything else
+var SEARCH_FIELDS = []struct {
+	Name   string
+	Weight int
+}{
+	{"key", 4},
+	{"username", 2},
+	{"url", 2},
+	{"type", 2},
+	{"description", 1},
+	{"notes", 1},
+}
+
+// FuzzyMatch matches pattern as a subsequence of text, returning the score
+// and the (rune) positions of the matched characters
+func FuzzyMatch(pattern string, text string, caseSensitive bool) (int, []int, bool) {
+	p := []rune(pattern)
+	t := []rune(text)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	folded := t
+	if !caseSensitive {
+		p = []rune(strings.ToLower(pattern))
+		folded = []rune(strings.ToLower(text))
+		if len(folded) != len(t) {
+			// a rune changed length when lowered; fall back to the original
+			folded = t
+		}
+	}
+
+	// the shortest window ending at the first full match: scan forward to
+	// find where it ends, then back to find where it starts
+	pi, end := 0, -1
+	for i := 0; i < len(folded) && pi < len(p); i++ {
+		if folded[i] == p[pi] {
+			pi++
+			if pi == len(p) {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	start := end
+	for pi = len(p) - 1; start >= 0; start-- {
+		if folded[start] == p[pi] {
+			pi--
+			if pi < 0 {
+				break
+			}
+		}
+	}
+	positions := make([]int, 0, len(p))
+	pi = 0
+	for i := start; i <= end && pi < len(p); i++ {
+		if folded[i] == p[pi] {
+			positions = append(positions, i)
+			pi++
+		}
+	}
+	score := fuzzyScore(t, positions)
+
+	// a contiguous occurrence (preferring one at a word boundary) can beat
+	// the shortest window
+	needle := string(p)
+	haystack := string(folded)
+	for offset := 0; ; {
+		index := strings.Index(haystack[offset:], needle)
+		if index < 0 {
+			break
+		}
+		first := len([]rune(haystack[:offset+index]))
+		contiguous := make([]int, len(p))
+		for i := range contiguous {
+			contiguous[i] = first + i
+		}
+		if s := fuzzyScore(t, contiguous); s > score {
+			score, positions = s, contiguous
+		}
+		offset += index + len(string(p[0]))
+	}
+	return score, positions, true
+}
+
+func fuzzyScore(text []rune, positions []int) int {
+	score := 0
+	for i, pos := range positions {
+		score += FUZZY_MATCH
+		if i > 0 && pos == positions[i-1]+1 {
+			score += FUZZY_CONSECUTIVE
+			continue
+		}
+		if i > 0 {
+			score -= FUZZY_GAP_OPEN + FUZZY_GAP*(pos-positions[i-1]-1)
+		}
+		if pos == 0 {
+			score += FUZZY_START
+		} else if isWordBoundary(text[pos-1], text[pos]) {
+			score += FUZZY_BOUNDARY
+		}
+	}
+	return score
+}
+
+func isWordBoundary(previous rune, current rune) bool {
+	if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+		return true
+	}
+	return unicode.IsLower(previous) && unicode.IsUpper(current)
+}
+
+// SearchResult is an entry that matched, with where the best match was
+type SearchResult struct {
+	Entry     DBEntry
+	Score     int
+	Field     string
+	Positions []int
+}
+
+// SearchEntries fuzzy matches the term against each entry's fields, scoring
+// each by its best field, and returns the matches best first. Matches spread
+// so thinly they score nothing are dropped.
+func SearchEntries(entries []DBEntry, term string, caseSensitive bool) []SearchResult {
+	results := make([]SearchResult, 0)
+	for _, entry := range entries {
+		best := SearchResult{Entry: entry}
+		for _, field := range SEARCH_FIELDS {
+			text, _ := EntryField(entry, field.Name)
+			score, positions, ok := FuzzyMatch(term, text, caseSensitive)
+			if ok && score*field.Weight > best.Score {
+				best.Score, best.Field, best.Positions = score*field.Weight, field.Name, positions
+			}
+		}
+		if best.Score > 0 {
+			results = append(results, best)
+		}
+	}
+	sort.SliceStable(results, func(a int, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return strings.ToLower(results[a].Entry.Key) < strings.ToLower(results[b].Entry.Key)
+	})
+	return results
+}
+
+// Highlight wraps the runes at positions in the start/end sequences
+func Highlight(text string, positions []int, start string, end string) string {
+	marked := make(map[int]bool)
+	for _, pos := range positions {
+		marked[pos] = true
+	}
+	var sb strings.Builder
+	for i, r := range []rune(text) {
+		if marked[i] {
+			sb.WriteString(start)
+			sb.WriteRune(r)
+			sb.WriteString(end)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	if _, _, ok := FuzzyMatch("github", "GitHub-Work", false); !ok {
+		t.Fatalf("expected a case-insensitive match")
+	}
+	if _, _, ok := FuzzyMatch("github", "GitHub-Work", true); ok {
+		t.Fatalf("expected no case-sensitive match")
+	}
+	_, positions, ok := FuzzyMatch("ghw", "GitHub-Work", false)
+	if !ok || len(positions) != 3 || positions[0] != 0 || positions[1] != 3 || positions[2] != 7 {
+		t.Fatalf("unexpected positions %v", positions)
+	}
+
+	contiguous, _, _ := FuzzyMatch("hub", "github", false)
+	scattered, _, _ := FuzzyMatch("hub", "h-u-b", false)
+	if contiguous <= scattered {
+		t.Fatalf("expected a contiguous match (%v) to beat a scattered one (%v)", contiguous, scattered)
+	}
+}
+
+func TestSearchEntriesRanksKeys(t *testing.T) {
+	entries := []DBEntry{
+		{Key: "aws", Notes: "see github for the runbook"},
+		{Key: "zz-GitHub-Work"},
+		{Key: "github"},
+		{Key: "unrelated"},
+	}
+	results := SearchEntries(entries, "github", false)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", len(results))
+	}
+	if results[0].Entry.Key != "github" || results[1].Entry.Key != "zz-GitHub-Work" || results[2].Entry.Key != "aws" || results[2].Field != "notes" {
+		t.Fatalf("unexpected order %v %v %v", results[0].Entry.Key, results[1].Entry.Key, results[2].Entry.Key)
+	}
+	if got := Highlight("github", results[0].Positions, "[", "]"); got != "[g][i][t][h][u][b]" {
+		t.Fatalf("unexpected highlight %v", got)
+	}
+}
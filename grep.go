@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	cli "github.com/simonski/cli"
+)
+
+// GREP_FIELDS are searched by kp grep; the value only with -values
+var GREP_FIELDS = []string{"description", "notes", "username", "url"}
+
+// GrepMatch is a field of an entry that matched; the matching lines are only
+// filled in when revealed
+type GrepMatch struct {
+	Key   string   `json:"key"`
+	Field string   `json:"field"`
+	Lines []string `json:"lines,omitempty"`
+}
+
+// GrepPattern compiles a kp grep pattern: a substring, or a regular
+// expression with regex set
+func GrepPattern(pattern string, regex bool, ignoreCase bool) (*regexp.Regexp, error) {
+	if !regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// GrepVault searches the entries one at a time, in key order, calling found
+// for each field that matches. Values are decrypted one by one (and only
+// when values is set) so the vault is never held in plaintext; an entry that
+// cannot be decrypted is reported to failed and skipped.
+func GrepVault(db *KPDB, pattern *regexp.Regexp, values bool, includeHidden bool, reveal bool,
+	found func(GrepMatch), failed func(key string, err error)) {
+	keys := make([]string, 0)
+	for key, entry := range db.GetData().Entries {
+		if includeHidden || !entry.Hidden {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry := db.GetData().Entries[key]
+		fields := GREP_FIELDS
+		if values {
+			value, err := db.Decrypt(entry.Value)
+			if err != nil {
+				failed(key, err)
+				continue
+			}
+			entry.Value = value
+			fields = append([]string{"value"}, GREP_FIELDS...)
+		}
+		for _, field := range fields {
+			text, _ := EntryField(entry, field)
+			if !pattern.MatchString(text) {
+				continue
+			}
+			match := GrepMatch{Key: key, Field: field}
+			if reveal {
+				for _, line := range strings.Split(text, "\n") {
+					if pattern.MatchString(line) {
+						match.Lines = append(match.Lines, line)
+					}
+				}
+			}
+			found(match)
+		}
+	}
+}
+
+// DoGrep is "kp grep <pattern>"
+func DoGrep(c *cli.CLI) {
+	pattern, err := GrepPattern(Positionals(c)[0], HasFlag(c, "-regex"), HasFlag(c, "-i"))
+	if err != nil {
+		Fail(c, ERR_USAGE, "Error, %v", err)
+	}
+	db := LoadDB()
+
+	count := 0
+	matches := make([]GrepMatch, 0)
+	found := func(match GrepMatch) {
+		count++
+		switch {
+		case IsJSONL(c):
+			PrintJSON(c, match)
+		case IsJSON(c):
+			matches = append(matches, match)
+		case len(match.Lines) > 0:
+			for _, line := range match.Lines {
+				fmt.Printf("%v (%v): %v\n", match.Key, match.Field, line)
+			}
+		default:
+			fmt.Printf("%v (%v)\n", match.Key, match.Field)
+		}
+	}
+	failed := func(key string, err error) {
+		fmt.Fprintf(os.Stderr, "Error, cannot decrypt '%v': %v\n", key, err)
+	}
+	GrepVault(db, pattern, HasFlag(c, "-values"), HasFlag(c, "-a"), HasFlag(c, "-reveal"), found, failed)
+
+	if IsJSON(c) && !IsJSONL(c) {
+		PrintJSONList(c, matches)
+	}
+	if count == 0 {
+		if !IsJSON(c) {
+			fmt.Println("No matches.")
+		}
+		os.Exit(1)
+	}
+}
@@ -14,7 +14,8 @@ import (
 )
 
 type GUI struct {
-	DB *KPDB
+	DB    *KPDB
+	Query *Query // when set, only the matching entries are shown
 }
 
 func NewGUI(db *KPDB) *GUI {
@@ -23,20 +24,36 @@ func NewGUI(db *KPDB) *GUI {
 }
 
 func (g *GUI) Run() {
+	entries := make([]DBEntry, 0)
+	for _, e := range g.DB.GetEntriesSortedByUpdatedThenKey() {
+		if g.Query == nil || g.Query.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("No entries found.")
+		return
+	}
+
 	if err := ui.Init(); err != nil {
 		log.Fatalf("failed to initialize termui: %v", err)
 	}
 
+	// namespaces start folded, unless a query picked the entries
+	tree := NewTreeList(entries, g.Query != nil)
+	byKey := make(map[string]DBEntry)
+	for _, e := range entries {
+		byKey[e.Key] = e
+	}
+
 	list := widgets.NewList()
 	list.Title = "Entries"
-	entries := g.DB.GetEntriesSortedByUpdatedThenKey()
-	s := make([]string, 0)
 	max_key := 0
 	for _, e := range entries {
-		s = append(s, e.Key)
 		max_key = goutils.Max(max_key, len(e.Key))
 	}
-	list.Rows = s
+	rows := tree.Rows()
+	list.Rows = tree.Labels(rows)
 	list.TextStyle = ui.NewStyle(ui.ColorYellow)
 	list.WrapText = false
 	list.SetRect(0, 0, 25, 25)
@@ -55,28 +72,53 @@ func (g *GUI) Run() {
 	table.ColumnWidths = []int{max_key + 1, 80}
 
 	index := 0
-	current_entry := entries[index]
-	g.drawTable(table, current_entry, index, table_width)
-
-	ui.Render(list)
-	ui.Render(table)
+	draw := func() {
+		current := rows[index].Node
+		if current.IsKey {
+			g.drawTable(table, byKey[current.Path], index, table_width)
+		} else {
+			g.drawNamespace(table, current, index)
+		}
+		ui.Render(list)
+		ui.Render(table)
+	}
+	draw()
 
 	output := ""
 	quit := false
 	for e := range ui.PollEvents() {
 		if e.Type == ui.KeyboardEvent {
+			current := rows[index].Node
+			selected := ""
 			switch e.ID {
 			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
 				index, _ = strconv.Atoi(e.ID)
 				index -= 1
 			case "g", "G":
-				index = len(entries) - 1
+				index = len(rows) - 1
 			case "s", "j", "<Down>":
 				index += 1
 			case "w", "k", "<Up>":
 				index -= 1
+			case "d", "l", "<Right>":
+				if !current.IsKey {
+					tree.Expanded[current.Path] = true
+					selected = current.Path
+				}
+			case "a", "h", "<Left>":
+				// folds the namespace, or the one the entry is in
+				selected = current.Path
+				if current.IsKey || !tree.Expanded[selected] {
+					selected = ParentNamespace(selected)
+				}
+				delete(tree.Expanded, selected)
 			case "<Return>", "<Enter>":
-				entry, _ := g.DB.GetDecrypted(current_entry.Key)
+				if !current.IsKey {
+					tree.Toggle(current.Path)
+					selected = current.Path
+					break
+				}
+				entry, _ := g.DB.GetDecrypted(current.Path)
 				clipboard.WriteAll(entry.Value)
 				quit = true
 			case "q", "Q", "<C-c>":
@@ -85,12 +127,21 @@ func (g *GUI) Run() {
 				quit = true
 			}
 
-			if index >= len(entries) {
+			// folding and unfolding keeps the namespace selected
+			if selected != "" {
+				rows = tree.Rows()
+				list.Rows = tree.Labels(rows)
+				for i, row := range rows {
+					if row.Node.Path == selected {
+						index = i
+					}
+				}
+			}
+			if index >= len(rows) {
 				index = 0
 			} else if index < 0 {
-				index = len(entries) - 1
+				index = len(rows) - 1
 			}
-			current_entry = entries[index]
 			list.ScrollTop()
 			list.ScrollAmount(index)
 		}
@@ -98,9 +149,7 @@ func (g *GUI) Run() {
 		if quit {
 			break
 		}
-		g.drawTable(table, current_entry, index, table_width)
-		ui.Render(list)
-		ui.Render(table)
+		draw()
 	}
 	ui.Close()
 	if output != "" {
@@ -108,6 +157,18 @@ func (g *GUI) Run() {
 	}
 }
 
+// drawNamespace shows what is under a namespace
+func (g *GUI) drawNamespace(table *widgets.Table, node *KeyNode, index int) {
+	table.Title = fmt.Sprintf("Table [%v]", index)
+	namespaces, keys := node.Count()
+	table.Rows = [][]string{
+		{"Namespace", node.Path},
+		{"Namespaces", fmt.Sprint(namespaces)},
+		{"Keys", fmt.Sprint(keys)},
+		{"", ""},
+	}
+}
+
 func (g *GUI) drawTable(table *widgets.Table, entry DBEntry, index int, table_width int) {
 
 	table.Title = fmt.Sprintf("Table [%v]", index)
@@ -132,9 +193,10 @@ func (g *GUI) drawTable(table *widgets.Table, entry DBEntry, index int, table_wi
 	rows = append(rows, []string{"Type", entry.Type})
 	rows = append(rows, []string{"Url", entry.Url})
 	rows = append(rows, []string{"Username", entry.Username})
+	rows = append(rows, []string{"Tags", strings.Join(entry.TagList(), ", ")})
 
 	rows = append(rows, []string{"LastUpdated", entry.LastUpdated.Format(time.RFC822)})
-	rows = append(rows, []string{"Created", entry.LastUpdated.Format(time.RFC822)})
+	rows = append(rows, []string{"Created", entry.Created.Format(time.RFC822)})
 
 	splits = g.SplitText(entry.Notes, table_width)
 	if len(splits) > 1 {
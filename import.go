@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cli "github.com/simonski/cli"
+	crypto "github.com/simonski/goutils/crypto"
+)
+
+// what to do when an imported key already exists
+const (
+	CONFLICT_SKIP      = "skip"
+	CONFLICT_OVERWRITE = "overwrite"
+	CONFLICT_SUFFIX    = "suffix"
+	CONFLICT_NEWEST    = "newest" // overwrite when the imported entry was updated more recently
+)
+
+var CONFLICT_POLICIES = []string{CONFLICT_SKIP, CONFLICT_OVERWRITE, CONFLICT_SUFFIX, CONFLICT_NEWEST}
+
+// actions recorded against each imported entry
+const (
+	IMPORT_NEW       = "new"
+	IMPORT_OVERWRITE = "overwrite"
+	IMPORT_SKIP      = "skip"
+	IMPORT_RENAME    = "rename"
+	IMPORT_DELETE    = "delete" // merges only
+)
+
+// ImportAction records what happened (or would happen) to one entry
+type ImportAction struct {
+	Action string
+	Key    string // the key the entry was stored under
+	From   string // the key it was imported as, when renamed
+}
+
+// ImportSummary is the outcome of an import
+type ImportSummary struct {
+	Actions []ImportAction
+	DryRun  bool
+}
+
+// Count returns the number of entries with the given action
+func (s ImportSummary) Count(action string) int {
+	count := 0
+	for _, a := range s.Actions {
+		if a.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Print writes the summary; a dry run lists every entry
+func (s ImportSummary) Print() {
+	if s.DryRun {
+		for _, a := range s.Actions {
+			if a.Action == IMPORT_RENAME {
+				fmt.Printf("    %-10v %v (from %v)\n", a.Action, a.Key, a.From)
+			} else {
+				fmt.Printf("    %-10v %v\n", a.Action, a.Key)
+			}
+		}
+		fmt.Printf("\nDry run, nothing was saved. ")
+	}
+	deleted := ""
+	if count := s.Count(IMPORT_DELETE); count > 0 {
+		deleted = fmt.Sprintf(", %v deleted", count)
+	}
+	fmt.Printf("%v entries: %v new, %v overwritten, %v renamed, %v skipped%v.\n",
+		len(s.Actions), s.Count(IMPORT_NEW), s.Count(IMPORT_OVERWRITE), s.Count(IMPORT_RENAME), s.Count(IMPORT_SKIP), deleted)
+}
+
+// ImportEntries stores entries (values in plaintext) in the db, resolving
+// keys that already exist with the policy. Created and LastUpdated are kept
+// when the source has them. The db is not saved, and nothing is changed on
+// a dry run.
+func ImportEntries(db *KPDB, entries []DBEntry, policy string, dryRun bool) ImportSummary {
+	summary := ImportSummary{Actions: make([]ImportAction, 0), DryRun: dryRun}
+	taken := make(map[string]bool)
+	for key := range db.GetData().Entries {
+		taken[key] = true
+	}
+
+	for _, entry := range entries {
+		action := ImportAction{Action: IMPORT_NEW, Key: entry.Key}
+		if taken[entry.Key] {
+			switch policy {
+			case CONFLICT_OVERWRITE:
+				action.Action = IMPORT_OVERWRITE
+			case CONFLICT_SUFFIX:
+				action.Action = IMPORT_RENAME
+				action.From = entry.Key
+				action.Key = SuffixedKey(entry.Key, taken)
+			case CONFLICT_NEWEST:
+				action.Action = IMPORT_SKIP
+				if entry.LastUpdated.After(db.GetData().Entries[entry.Key].LastUpdated) {
+					action.Action = IMPORT_OVERWRITE
+				}
+			default:
+				action.Action = IMPORT_SKIP
+			}
+		}
+		summary.Actions = append(summary.Actions, action)
+		if action.Action == IMPORT_SKIP {
+			continue
+		}
+		taken[action.Key] = true
+		if dryRun {
+			continue
+		}
+
+		entry.Key = action.Key
+		db.Put(entry)
+		stored := db.GetData().Entries[entry.Key]
+		if !entry.Created.IsZero() {
+			stored.Created = entry.Created
+		}
+		if !entry.LastUpdated.IsZero() {
+			stored.LastUpdated = entry.LastUpdated
+		}
+		db.GetData().Entries[entry.Key] = stored
+	}
+	return summary
+}
+
+// SuffixedKey returns the first of key-2, key-3... that is not taken
+func SuffixedKey(key string, taken map[string]bool) string {
+	for index := 2; ; index++ {
+		candidate := fmt.Sprintf("%v-%v", key, index)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// DoImport is "kp import [csv|kdbx|kpx] <file>"; without a format it is
+// taken from the file extension, and is a kp bundle otherwise
+func DoImport(c *cli.CLI) {
+	positionals := Positionals(c)
+	format, filename := importFormat(positionals)
+	policy := FlagString(c, "-on-conflict", CONFLICT_SKIP)
+	if !contains(CONFLICT_POLICIES, policy) {
+		fmt.Printf("Error, -on-conflict must be one of %v.\n", CONFLICT_POLICIES)
+		os.Exit(1)
+	}
+	dryRun := HasFlag(c, "-dry-run")
+
+	var entries []DBEntry
+	var err error
+	switch format {
+	case "csv":
+		entries, err = ReadCSVFile(filename, FlagString(c, "-format", ""), FlagString(c, "-map", ""))
+	case "kdbx":
+		groups := FlagString(c, "-groups", GROUPS_PREFIX)
+		if groups != GROUPS_PREFIX && groups != GROUPS_TAGS {
+			fmt.Printf("Error, -groups must be %v or %v.\n", GROUPS_PREFIX, GROUPS_TAGS)
+			os.Exit(1)
+		}
+		password, perr := ReadPassphrase("Master password", false)
+		if perr != nil {
+			fmt.Printf("Error, %v\n", perr)
+			os.Exit(1)
+		}
+		entries, err = ReadKDBXFile(filename, password, groups)
+	case BUNDLE_FORMAT:
+		DoImportBundle(c, filename, policy, dryRun)
+		return
+	default:
+		fmt.Printf("Error, cannot import '%v', the formats are: csv, kdbx, kpx\n", format)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+
+	db := LoadDB()
+	summary := ImportEntries(db, entries, policy, dryRun)
+	if !dryRun {
+		db.Save()
+	}
+	summary.Print()
+}
+
+func importFormat(positionals []string) (string, string) {
+	if len(positionals) > 1 {
+		return positionals[0], positionals[1]
+	}
+	filename := positionals[0]
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv", filename
+	case ".kdbx":
+		return "kdbx", filename
+	}
+	return BUNDLE_FORMAT, filename
+}
+
+// DoImportBundle merges a kp bundle into the vault; a recipient bundle is
+// opened with the vault's own key, otherwise the passphrase is asked for
+func DoImportBundle(c *cli.CLI, filename string, policy string, dryRun bool) {
+	bundle, err := ReadBundleFile(filename)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	db := LoadDB()
+	var data BundleData
+	if bundle.Mode == BUNDLE_RECIPIENT {
+		privateKey, kerr := crypto.LoadPrivateKey(db.PrivateKeyFilename)
+		if kerr != nil {
+			fmt.Printf("Error, %v\n", kerr)
+			os.Exit(1)
+		}
+		data, err = bundle.Open("", privateKey)
+	} else {
+		passphrase, perr := ReadPassphrase("Bundle passphrase", false)
+		if perr != nil {
+			fmt.Printf("Error, %v\n", perr)
+			os.Exit(1)
+		}
+		data, err = bundle.Open(passphrase, nil)
+	}
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+
+	summary := ImportBundle(db, data, policy, dryRun)
+	if !dryRun {
+		db.Save()
+	}
+	summary.Print()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// CSVMapping names the column each DBEntry field is read from; an empty
+// column is not imported
+type CSVMapping struct {
+	Key      string
+	Value    string
+	Url      string
+	Username string
+	Notes    string
+	Type     string
+	Tags     string
+}
+
+// CSV_FORMATS are the built-in mappings for browser and password manager
+// exports
+var CSV_FORMATS = map[string]CSVMapping{
+	"chrome":    {Key: "name", Value: "password", Url: "url", Username: "username", Notes: "note"},
+	"firefox":   {Value: "password", Url: "url", Username: "username"},
+	"lastpass":  {Key: "name", Value: "password", Url: "url", Username: "username", Notes: "extra", Tags: "grouping"},
+	"bitwarden": {Key: "name", Value: "login_password", Url: "login_uri", Username: "login_username", Notes: "notes", Type: "type", Tags: "folder"},
+}
+
+// LASTPASS_NOTE_URL is the url LastPass gives secure notes
+const LASTPASS_NOTE_URL = "http://sn"
+
+// DetectCSVFormat guesses the export format from the header row
+func DetectCSVFormat(header []string) string {
+	columns := make(map[string]bool)
+	for _, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = true
+	}
+	if columns["login_password"] {
+		return "bitwarden"
+	} else if columns["grouping"] && columns["extra"] {
+		return "lastpass"
+	} else if columns["httprealm"] || columns["formactionorigin"] {
+		return "firefox"
+	} else if columns["name"] && columns["url"] && columns["username"] && columns["password"] {
+		return "chrome"
+	}
+	return ""
+}
+
+// ParseCSVMapping applies a -map specification such as
+// "key=Title,value=Password,tags=Group" on top of a mapping
+func ParseCSVMapping(spec string, mapping CSVMapping) (CSVMapping, error) {
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		field, column, found := strings.Cut(pair, "=")
+		if !found {
+			return mapping, fmt.Errorf("-map expects field=column pairs, got '%v'", pair)
+		}
+		column = strings.TrimSpace(column)
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "key":
+			mapping.Key = column
+		case "value", "password":
+			mapping.Value = column
+		case "url":
+			mapping.Url = column
+		case "username":
+			mapping.Username = column
+		case "notes", "note":
+			mapping.Notes = column
+		case "type":
+			mapping.Type = column
+		case "tags", "tag":
+			mapping.Tags = column
+		default:
+			return mapping, fmt.Errorf("-map has an unknown field '%v', use key, value, url, username, notes, type or tags", field)
+		}
+	}
+	return mapping, nil
+}
+
+// ReadCSVFile reads entries from a CSV export
+func ReadCSVFile(filename string, format string, spec string) ([]DBEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadCSV(file, format, spec)
+}
+
+// ReadCSV reads entries from a CSV export using a built-in format (detected
+// from the header when format is "") and/or a -map specification
+func ReadCSV(r io.Reader, format string, spec string) ([]DBEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the csv header: %v", err)
+	}
+
+	if format == "" {
+		format = DetectCSVFormat(header)
+	}
+	mapping := CSVMapping{}
+	if format != "" {
+		known, exists := CSV_FORMATS[format]
+		if !exists {
+			return nil, fmt.Errorf("unknown csv format '%v', the formats are chrome, firefox, lastpass and bitwarden", format)
+		}
+		mapping = known
+	} else if spec == "" {
+		return nil, fmt.Errorf("cannot detect the csv format, use -format or -map")
+	}
+	mapping, err = ParseCSVMapping(spec, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{mapping.Key, mapping.Value, mapping.Url, mapping.Username, mapping.Notes, mapping.Type, mapping.Tags} {
+		if _, exists := index[strings.ToLower(column)]; column != "" && !exists {
+			return nil, fmt.Errorf("the csv has no '%v' column", column)
+		}
+	}
+
+	entries := make([]DBEntry, 0)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// the metadata is trimmed, the value is kept exactly as it is
+		raw := func(column string) string {
+			i, exists := index[strings.ToLower(column)]
+			if column == "" || !exists || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+		get := func(column string) string {
+			return strings.TrimSpace(raw(column))
+		}
+
+		entry := DBEntry{
+			Key:      get(mapping.Key),
+			Value:    raw(mapping.Value),
+			Url:      get(mapping.Url),
+			Username: get(mapping.Username),
+			Notes:    get(mapping.Notes),
+			Type:     get(mapping.Type),
+			Tags:     tagSet([]string{get(mapping.Tags)}),
+		}
+		if format == "bitwarden" && get("fields") != "" {
+			entry.Notes = strings.TrimSpace(entry.Notes + "\n" + get("fields"))
+		}
+		if entry.Url == LASTPASS_NOTE_URL {
+			entry.Url = ""
+			entry.Type = "note"
+		}
+		if entry.Type == "" && format != "" {
+			entry.Type = "login"
+		}
+		if entry.Key == "" {
+			entry.Key = csvKey(entry, row)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// csvKey makes a key for a row without a name, e.g. "github.com/bob"
+func csvKey(entry DBEntry, row int) string {
+	host := ""
+	if u, err := url.Parse(entry.Url); err == nil {
+		host = u.Hostname()
+	}
+	if host != "" && entry.Username != "" {
+		return host + "/" + entry.Username
+	} else if host != "" {
+		return host
+	} else if entry.Username != "" {
+		return entry.Username
+	}
+	return fmt.Sprintf("imported-%v", row)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadCSVBitwarden(t *testing.T) {
+	data := `folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp
+Work,,login,GitHub,my notes,,0,https://github.com,bob,gh-pass,
+`
+	entries, err := ReadCSV(strings.NewReader(data), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %v", len(entries))
+	}
+	e := entries[0]
+	if e.Key != "GitHub" || e.Value != "gh-pass" || e.Username != "bob" || e.Url != "https://github.com" || e.Notes != "my notes" || e.Type != "login" || !e.Tags["work"] {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestReadCSVCustomMap(t *testing.T) {
+	data := "Title,Secret,Group\nrouter,hunter2,home\n"
+	entries, err := ReadCSV(strings.NewReader(data), "", "key=Title,value=Secret,tags=Group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Key != "router" || entries[0].Value != "hunter2" || !entries[0].Tags["home"] {
+		t.Fatalf("unexpected entry %+v", entries[0])
+	}
+
+	// the value keeps its spaces, the metadata does not
+	entries, err = ReadCSV(strings.NewReader("Title,Secret,Group\n router , pass word  , home \n"), "", "key=Title,value=Secret,tags=Group")
+	if err != nil || entries[0].Key != "router" || entries[0].Value != " pass word  " || !entries[0].Tags["home"] {
+		t.Fatalf("unexpected entry %+v (%v)", entries[0], err)
+	}
+
+	_, err = ReadCSV(strings.NewReader(data), "", "key=Name")
+	if err == nil {
+		t.Fatalf("expected an error for a missing column")
+	}
+}
+
+func TestImportEntriesConflicts(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "github", Value: "old"})
+	incoming := []DBEntry{{Key: "github", Value: "new"}, {Key: "gitlab", Value: "other"}}
+
+	summary := ImportEntries(db, incoming, CONFLICT_SKIP, false)
+	if summary.Count(IMPORT_SKIP) != 1 || summary.Count(IMPORT_NEW) != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	summary = ImportEntries(db, incoming[:1], CONFLICT_SUFFIX, true)
+	if summary.Actions[0].Key != "github-2" {
+		t.Fatalf("expected github-2, got %v", summary.Actions[0].Key)
+	}
+	if _, exists := db.GetData().Entries["github-2"]; exists {
+		t.Fatalf("a dry run must not change the db")
+	}
+
+	ImportEntries(db, incoming[:1], CONFLICT_OVERWRITE, false)
+	entry, _ := db.GetDecrypted("github")
+	if entry.Value != "new" {
+		t.Fatalf("expected overwrite, got %v", entry.Value)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	cli "github.com/simonski/cli"
+)
+
+// DoInject renders a template file, replacing {{ kp "key" "field" }}
+// references with values from the vault
+func DoInject(c *cli.CLI) {
+	input := FlagString(c, "-i", "")
+	output := FlagString(c, "-o", "")
+	toStdout := HasFlag(c, "-stdout")
+	if input == "" || (output == "" && !toStdout) {
+		fmt.Print("Usage: kp inject -i <template> (-o <output> | -stdout)\n")
+		os.Exit(1)
+	}
+
+	text, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Printf("Error, cannot read '%v': %v\n", input, err)
+		os.Exit(1)
+	}
+
+	db := LoadDB()
+	rendered, err := RenderTemplate(db, input, string(text))
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+
+	if toStdout {
+		fmt.Print(rendered)
+		return
+	}
+	err = WritePrivateFile(output, []byte(rendered))
+	if err != nil {
+		fmt.Printf("Error, cannot write '%v': %v\n", output, err)
+		os.Exit(1)
+	}
+}
+
+// RenderTemplate executes the template text against the db; any reference
+// to a key or field that does not exist is an error
+func RenderTemplate(db *KPDB, name string, text string) (string, error) {
+	funcs := template.FuncMap{
+		"kp": func(key string, fields ...string) (string, error) {
+			if len(fields) > 1 {
+				return "", fmt.Errorf("kp takes a key and at most one field, got %v fields", len(fields))
+			}
+			field := "value"
+			if len(fields) == 1 {
+				field = fields[0]
+			}
+			entry, exists := db.GetDecrypted(key)
+			if !exists {
+				return "", fmt.Errorf("no entry '%v'", key)
+			}
+			return EntryField(entry, field)
+		},
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// EntryField returns the named field of an entry as a string. Nested fields
+// are addressed with a dot, e.g. "tags.prod" is "true" when the entry has
+// the tag "prod" and "false" otherwise.
+func EntryField(entry DBEntry, field string) (string, error) {
+	name, sub, nested := strings.Cut(field, ".")
+	if nested && strings.ToLower(name) != "tags" {
+		return "", fmt.Errorf("entry '%v' has no field '%v'", entry.Key, field)
+	}
+	switch strings.ToLower(name) {
+	case "key":
+		return entry.Key, nil
+	case "value":
+		return entry.Value, nil
+	case "description":
+		return entry.Description, nil
+	case "notes", "note":
+		return entry.Notes, nil
+	case "username":
+		return entry.Username, nil
+	case "url":
+		return entry.Url, nil
+	case "type":
+		return entry.Type, nil
+	case "hidden":
+		return strconv.FormatBool(entry.Hidden), nil
+	case "created":
+		return entry.Created.Format(time.RFC3339), nil
+	case "lastupdated", "updated":
+		return entry.LastUpdated.Format(time.RFC3339), nil
+	case "tags":
+		if nested {
+			return strconv.FormatBool(entry.Tags[sub]), nil
+		}
+		return strings.Join(entry.TagList(), ","), nil
+	}
+	return "", fmt.Errorf("entry '%v' has no field '%v'", entry.Key, field)
+}
+
+// WritePrivateFile writes data to filename readable only by the owner (0600).
+// It is written to a temporary file and renamed into place, so an existing
+// file (or a symlink) with looser permissions never holds the data.
+func WritePrivateFile(filename string, data []byte) error {
+	return writeAndRename(filename, data, 0600)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "db/prod", Value: "s3cret", Username: "admin", Tags: map[string]bool{"prod": true}})
+
+	text := `user={{ kp "db/prod" "username" }} pass={{ kp "db/prod" }} prod={{ kp "db/prod" "tags.prod" }} dev={{ kp "db/prod" "tags.dev" }}`
+	out, err := RenderTemplate(db, "test", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "user=admin pass=s3cret prod=true dev=false"
+	if out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestRenderTemplateMissing(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "db/prod", Value: "s3cret"})
+
+	_, err := RenderTemplate(db, "test", `{{ kp "db/missing" }}`)
+	if err == nil || !strings.Contains(err.Error(), "no entry 'db/missing'") {
+		t.Fatalf("expected missing entry error, got %v", err)
+	}
+	_, err = RenderTemplate(db, "test", `{{ kp "db/prod" "colour" }}`)
+	if err == nil || !strings.Contains(err.Error(), "no field 'colour'") {
+		t.Fatalf("expected missing field error, got %v", err)
+	}
+}
+
+func TestWritePrivateFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	os.WriteFile(existing, []byte("old"), 0644)
+	target := filepath.Join(dir, "target")
+	os.WriteFile(target, []byte("untouched"), 0644)
+	link := filepath.Join(dir, "link")
+	os.Symlink(target, link)
+
+	for _, filename := range []string{existing, link} {
+		if err := WritePrivateFile(filename, []byte("secret")); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(filename)
+		if err != nil || info.Mode() != 0600 {
+			t.Fatalf("expected %v to be a 0600 file, got %v (%v)", filename, info.Mode(), err)
+		}
+	}
+	if data, _ := os.ReadFile(target); string(data) != "untouched" {
+		t.Fatalf("the symlink was followed: %q", data)
+	}
+}
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// KDBX 4 (KeePass 2.35+) reading and writing, with a master password
+
+const (
+	KDBX_SIGNATURE1    = 0x9AA2D903
+	KDBX_SIGNATURE2    = 0xB54BFB67
+	KDBX_MAJOR_VERSION = 4
+
+	kdbxEndOfHeader      = 0
+	kdbxCipherID         = 2
+	kdbxCompressionFlags = 3
+	kdbxMasterSeed       = 4
+	kdbxEncryptionIV     = 7
+	kdbxKdfParameters    = 11
+	kdbxPublicCustomData = 12
+
+	kdbxInnerEnd       = 0
+	kdbxInnerStreamID  = 1
+	kdbxInnerStreamKey = 2
+	kdbxInnerBinary    = 3
+
+	kdbxStreamChaCha20 = 3
+
+	kdbxBlockSize = 1024 * 1024
+)
+
+var (
+	kdbxCipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	kdbxCipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	kdbxKdfAES         = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdbxKdfArgon2d     = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdbxKdfArgon2id    = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+
+	// kdbxEpoch is the zero of the KDBX 4 timestamps
+	kdbxEpoch = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// ErrKDBXPassword is returned when the header HMAC does not match, which is
+// almost always the wrong master password
+var ErrKDBXPassword = errors.New("wrong master password (or the file is corrupt)")
+
+// KDBX_ARGON2 are the Argon2d parameters used when writing; memory in KiB
+var KDBX_ARGON2 = struct {
+	Iterations  uint64
+	Memory      uint64
+	Parallelism uint32
+}{Iterations: 2, Memory: 64 * 1024, Parallelism: 2}
+
+// KDBX_MAX_AES_ROUNDS is the most AES-KDF rounds a file may ask for (see
+// ARGON2_MAX_TIME); KeePass benchmarks a second at a few million
+const KDBX_MAX_AES_ROUNDS = 1 << 30
+
+// KeePassFile is the XML document inside a KDBX file
+type KeePassFile struct {
+	XMLName xml.Name    `xml:"KeePassFile"`
+	Meta    KeePassMeta `xml:"Meta"`
+	Root    KeePassRoot `xml:"Root"`
+}
+
+type KeePassMeta struct {
+	Generator         string `xml:"Generator"`
+	DatabaseName      string `xml:"DatabaseName"`
+	RecycleBinEnabled string `xml:"RecycleBinEnabled,omitempty"`
+	RecycleBinUUID    string `xml:"RecycleBinUUID,omitempty"`
+}
+
+type KeePassRoot struct {
+	Groups []KeePassGroup `xml:"Group"`
+}
+
+type KeePassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Times   KeePassTimes   `xml:"Times"`
+	Entries []KeePassEntry `xml:"Entry"`
+	Groups  []KeePassGroup `xml:"Group"`
+}
+
+type KeePassEntry struct {
+	UUID    string          `xml:"UUID"`
+	Tags    string          `xml:"Tags"`
+	Times   KeePassTimes    `xml:"Times"`
+	Strings []KeePassString `xml:"String"`
+	History *KeePassHistory `xml:"History,omitempty"`
+}
+
+type KeePassHistory struct {
+	Entries []KeePassEntry `xml:"Entry"`
+}
+
+type KeePassTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+type KeePassString struct {
+	Key   string       `xml:"Key"`
+	Value KeePassValue `xml:"Value"`
+}
+
+// KeePassValue holds plaintext; Protected values are encrypted with the
+// inner stream only while the document is serialised
+type KeePassValue struct {
+	Protected string `xml:"Protected,attr,omitempty"`
+	Text      string `xml:",chardata"`
+}
+
+// Get returns the value of a string field
+func (e KeePassEntry) Get(key string) string {
+	for _, s := range e.Strings {
+		if s.Key == key {
+			return s.Value.Text
+		}
+	}
+	return ""
+}
+
+// NewKeePassTimes sets every timestamp from created/modified
+func NewKeePassTimes(created time.Time, modified time.Time) KeePassTimes {
+	return KeePassTimes{
+		CreationTime:         FormatKDBXTime(created),
+		LastModificationTime: FormatKDBXTime(modified),
+		LastAccessTime:       FormatKDBXTime(modified),
+		ExpiryTime:           FormatKDBXTime(modified),
+		Expires:              "False",
+		LocationChanged:      FormatKDBXTime(modified),
+	}
+}
+
+// FormatKDBXTime encodes a time as KDBX 4 does, base64 of the little-endian
+// seconds since 0001-01-01
+func FormatKDBXTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(t.Unix()-kdbxEpoch.Unix()))
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// ParseKDBXTime reads a KDBX 4 time, or the ISO 8601 form older files use
+func ParseKDBXTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if b, err := base64.StdEncoding.DecodeString(value); err == nil && len(b) == 8 {
+		return time.Unix(int64(binary.LittleEndian.Uint64(b))+kdbxEpoch.Unix(), 0).UTC()
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// NewKeePassUUID returns a random base64 UUID
+func NewKeePassUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// kdbxCompositeKey is the key KeePass derives from a master password alone
+func kdbxCompositeKey(password string) []byte {
+	h := sha256.Sum256([]byte(password))
+	composite := sha256.Sum256(h[:])
+	return composite[:]
+}
+
+// kdbxHeader is the outer header of a KDBX 4 file
+type kdbxHeader struct {
+	CipherID   []byte
+	Compressed bool
+	MasterSeed []byte
+	IV         []byte
+	KdfParams  map[string]interface{}
+	Raw        []byte
+	CustomData []byte
+}
+
+// ReadKDBX decrypts a KDBX 4 file with a master password
+func ReadKDBX(r io.Reader, password string) (*KeePassFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	header, rest, err := readKDBXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < 64 {
+		return nil, fmt.Errorf("the file is truncated")
+	}
+	headerHash := sha256.Sum256(header.Raw)
+	if !hmac.Equal(headerHash[:], rest[:32]) {
+		return nil, fmt.Errorf("the header is corrupt")
+	}
+
+	transformedKey, err := kdbxTransformKey(kdbxCompositeKey(password), header.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, hmacKey := kdbxKeys(header.MasterSeed, transformedKey)
+	if !hmac.Equal(kdbxHeaderHMAC(hmacKey, header.Raw), rest[32:64]) {
+		return nil, ErrKDBXPassword
+	}
+
+	payload, err := readKDBXBlocks(rest[64:], hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := kdbxDecrypt(header, encryptionKey, payload)
+	if err != nil {
+		return nil, err
+	}
+	if header.Compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return nil, err
+		}
+		plain, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stream, document, err := readKDBXInnerHeader(plain)
+	if err != nil {
+		return nil, err
+	}
+	document, err = kdbxTransformProtected(document, stream, false)
+	if err != nil {
+		return nil, err
+	}
+	file := KeePassFile{}
+	err = xml.Unmarshal(document, &file)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// WriteKDBX encrypts the document as KDBX 4 (AES-256, Argon2d, gzip and a
+// ChaCha20 inner stream) with a master password
+func WriteKDBX(w io.Writer, file *KeePassFile, password string) error {
+	header := kdbxHeader{
+		CipherID:   kdbxCipherAES256,
+		Compressed: true,
+		MasterSeed: kdbxRandom(32),
+		IV:         kdbxRandom(16),
+		KdfParams: map[string]interface{}{
+			"$UUID": kdbxKdfArgon2d,
+			"S":     kdbxRandom(32),
+			"P":     KDBX_ARGON2.Parallelism,
+			"M":     KDBX_ARGON2.Memory * 1024,
+			"I":     KDBX_ARGON2.Iterations,
+			"V":     uint32(argon2Version),
+		},
+	}
+	header.Raw = writeKDBXHeader(header)
+
+	transformedKey, err := kdbxTransformKey(kdbxCompositeKey(password), header.KdfParams)
+	if err != nil {
+		return err
+	}
+	encryptionKey, hmacKey := kdbxKeys(header.MasterSeed, transformedKey)
+
+	streamKey := kdbxRandom(64)
+	stream, err := kdbxInnerStream(kdbxStreamChaCha20, streamKey)
+	if err != nil {
+		return err
+	}
+	document, err := xml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	document, err = kdbxTransformProtected(append([]byte(xml.Header), document...), stream, true)
+	if err != nil {
+		return err
+	}
+
+	var inner bytes.Buffer
+	streamID := make([]byte, 4)
+	binary.LittleEndian.PutUint32(streamID, kdbxStreamChaCha20)
+	writeKDBXField(&inner, kdbxInnerStreamID, streamID)
+	writeKDBXField(&inner, kdbxInnerStreamKey, streamKey)
+	writeKDBXField(&inner, kdbxInnerEnd, nil)
+	inner.Write(document)
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(inner.Bytes())
+	zw.Close()
+
+	block, _ := aes.NewCipher(encryptionKey)
+	plain := compressed.Bytes()
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, header.IV).CryptBlocks(encrypted, plain)
+
+	var out bytes.Buffer
+	out.Write(header.Raw)
+	headerHash := sha256.Sum256(header.Raw)
+	out.Write(headerHash[:])
+	out.Write(kdbxHeaderHMAC(hmacKey, header.Raw))
+	index := uint64(0)
+	for start := 0; start <= len(encrypted); start += kdbxBlockSize {
+		end := start + kdbxBlockSize
+		if end > len(encrypted) {
+			end = len(encrypted)
+		}
+		writeKDBXBlock(&out, hmacKey, index, encrypted[start:end])
+		index++
+		if end == len(encrypted) {
+			break
+		}
+	}
+	writeKDBXBlock(&out, hmacKey, index, nil)
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+func kdbxRandom(size int) []byte {
+	b := make([]byte, size)
+	rand.Read(b)
+	return b
+}
+
+func readKDBXHeader(data []byte) (kdbxHeader, []byte, error) {
+	header := kdbxHeader{}
+	if len(data) < 12 || binary.LittleEndian.Uint32(data[0:4]) != KDBX_SIGNATURE1 || binary.LittleEndian.Uint32(data[4:8]) != KDBX_SIGNATURE2 {
+		return header, nil, fmt.Errorf("not a KeePass (kdbx) file")
+	}
+	major := binary.LittleEndian.Uint16(data[10:12])
+	if major != KDBX_MAJOR_VERSION {
+		return header, nil, fmt.Errorf("only KDBX 4 is supported, this file is version %v (save it as KDBX 4 in KeePass first)", major)
+	}
+	position := 12
+	for {
+		if position+5 > len(data) {
+			return header, nil, fmt.Errorf("the header is truncated")
+		}
+		id := data[position]
+		size := int(binary.LittleEndian.Uint32(data[position+1 : position+5]))
+		position += 5
+		if position+size > len(data) {
+			return header, nil, fmt.Errorf("the header is truncated")
+		}
+		value := data[position : position+size]
+		position += size
+		switch id {
+		case kdbxEndOfHeader:
+			header.Raw = data[:position]
+			if header.KdfParams == nil {
+				return header, nil, fmt.Errorf("the header has no key derivation parameters")
+			}
+			return header, data[position:], nil
+		case kdbxCipherID:
+			header.CipherID = value
+		case kdbxCompressionFlags:
+			header.Compressed = binary.LittleEndian.Uint32(value) == 1
+		case kdbxMasterSeed:
+			header.MasterSeed = value
+		case kdbxEncryptionIV:
+			header.IV = value
+		case kdbxKdfParameters:
+			params, err := readVariantDictionary(value)
+			if err != nil {
+				return header, nil, err
+			}
+			header.KdfParams = params
+		case kdbxPublicCustomData:
+			header.CustomData = value
+		}
+	}
+}
+
+func writeKDBXHeader(header kdbxHeader) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(KDBX_SIGNATURE1))
+	binary.Write(&b, binary.LittleEndian, uint32(KDBX_SIGNATURE2))
+	binary.Write(&b, binary.LittleEndian, uint16(0))
+	binary.Write(&b, binary.LittleEndian, uint16(KDBX_MAJOR_VERSION))
+	compression := make([]byte, 4)
+	if header.Compressed {
+		compression[0] = 1
+	}
+	writeKDBXField(&b, kdbxCipherID, header.CipherID)
+	writeKDBXField(&b, kdbxCompressionFlags, compression)
+	writeKDBXField(&b, kdbxMasterSeed, header.MasterSeed)
+	writeKDBXField(&b, kdbxEncryptionIV, header.IV)
+	writeKDBXField(&b, kdbxKdfParameters, writeVariantDictionary(header.KdfParams))
+	writeKDBXField(&b, kdbxEndOfHeader, []byte("\r\n\r\n"))
+	return b.Bytes()
+}
+
+func writeKDBXField(b *bytes.Buffer, id byte, value []byte) {
+	b.WriteByte(id)
+	binary.Write(b, binary.LittleEndian, uint32(len(value)))
+	b.Write(value)
+}
+
+// variant dictionary value types
+const (
+	vdUInt32    = 0x04
+	vdUInt64    = 0x05
+	vdBool      = 0x08
+	vdInt32     = 0x0C
+	vdInt64     = 0x0D
+	vdString    = 0x18
+	vdByteArray = 0x42
+)
+
+func readVariantDictionary(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if len(data) < 2 {
+		return nil, fmt.Errorf("the key derivation parameters are truncated")
+	}
+	position := 2 // version
+	for position < len(data) {
+		kind := data[position]
+		position++
+		if kind == 0 {
+			return result, nil
+		}
+		if position+4 > len(data) {
+			break
+		}
+		keyLength := int(binary.LittleEndian.Uint32(data[position:]))
+		position += 4
+		if position+keyLength+4 > len(data) {
+			break
+		}
+		key := string(data[position : position+keyLength])
+		position += keyLength
+		valueLength := int(binary.LittleEndian.Uint32(data[position:]))
+		position += 4
+		if position+valueLength > len(data) {
+			break
+		}
+		value := data[position : position+valueLength]
+		position += valueLength
+		switch kind {
+		case vdUInt32:
+			result[key] = binary.LittleEndian.Uint32(value)
+		case vdUInt64:
+			result[key] = binary.LittleEndian.Uint64(value)
+		case vdBool:
+			result[key] = value[0] != 0
+		case vdInt32:
+			result[key] = int32(binary.LittleEndian.Uint32(value))
+		case vdInt64:
+			result[key] = int64(binary.LittleEndian.Uint64(value))
+		case vdString:
+			result[key] = string(value)
+		default:
+			result[key] = value
+		}
+	}
+	return nil, fmt.Errorf("the key derivation parameters are truncated")
+}
+
+func writeVariantDictionary(values map[string]interface{}) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(0x0100))
+	keys := make([]string, 0)
+	for key := range values {
+		keys = append(keys, key)
+	}
+	// $UUID first, as KeePass writes it
+	keys = append([]string{"$UUID"}, filterOut(keys, "$UUID")...)
+	for _, key := range keys {
+		var kind byte
+		var value []byte
+		switch v := values[key].(type) {
+		case uint32:
+			kind = vdUInt32
+			value = binary.LittleEndian.AppendUint32(nil, v)
+		case uint64:
+			kind = vdUInt64
+			value = binary.LittleEndian.AppendUint64(nil, v)
+		case []byte:
+			kind = vdByteArray
+			value = v
+		default:
+			continue
+		}
+		b.WriteByte(kind)
+		binary.Write(&b, binary.LittleEndian, uint32(len(key)))
+		b.WriteString(key)
+		binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+	}
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+func filterOut(values []string, value string) []string {
+	result := make([]string, 0)
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// kdbxTransformKey runs the key derivation function named in the parameters
+func kdbxTransformKey(composite []byte, params map[string]interface{}) ([]byte, error) {
+	uuid, _ := params["$UUID"].([]byte)
+	switch {
+	case bytes.Equal(uuid, kdbxKdfArgon2d), bytes.Equal(uuid, kdbxKdfArgon2id):
+		salt, _ := params["S"].([]byte)
+		parallelism, _ := params["P"].(uint32)
+		memory, _ := params["M"].(uint64)
+		iterations, _ := params["I"].(uint64)
+		version, _ := params["V"].(uint32)
+		secret, _ := params["K"].([]byte)
+		data, _ := params["A"].([]byte)
+		if version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version 0x%x", version)
+		}
+		if err := CheckArgon2(iterations, memory/1024, uint64(parallelism)); err != nil {
+			return nil, err
+		}
+		variant := ARGON2D
+		if bytes.Equal(uuid, kdbxKdfArgon2id) {
+			variant = ARGON2ID
+		}
+		return Argon2(variant, composite, salt, secret, data, uint32(iterations), uint32(memory/1024), parallelism, 32), nil
+	case bytes.Equal(uuid, kdbxKdfAES):
+		seed, _ := params["S"].([]byte)
+		rounds, _ := params["R"].(uint64)
+		if rounds > KDBX_MAX_AES_ROUNDS {
+			return nil, fmt.Errorf("the AES-KDF asks for %v rounds, over the limit of %v", rounds, uint64(KDBX_MAX_AES_ROUNDS))
+		}
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte{}, composite...)
+		for i := uint64(0); i < rounds; i++ {
+			block.Encrypt(key[0:16], key[0:16])
+			block.Encrypt(key[16:32], key[16:32])
+		}
+		transformed := sha256.Sum256(key)
+		return transformed[:], nil
+	}
+	return nil, fmt.Errorf("unsupported key derivation function")
+}
+
+// kdbxKeys derives the payload encryption key and the HMAC base key
+func kdbxKeys(masterSeed []byte, transformedKey []byte) ([]byte, []byte) {
+	encryptionKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformedKey...))
+	hmacKey := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformedKey...), 0x01))
+	return encryptionKey[:], hmacKey[:]
+}
+
+// kdbxBlockKey is the HMAC key for a block; the header uses index 2^64-1
+func kdbxBlockKey(hmacKey []byte, index uint64) []byte {
+	blockKey := sha512.Sum512(append(binary.LittleEndian.AppendUint64(nil, index), hmacKey...))
+	return blockKey[:]
+}
+
+func kdbxHeaderHMAC(hmacKey []byte, header []byte) []byte {
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, ^uint64(0)))
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+func kdbxBlockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey, index))
+	mac.Write(binary.LittleEndian.AppendUint64(nil, index))
+	mac.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func readKDBXBlocks(data []byte, hmacKey []byte) ([]byte, error) {
+	var payload bytes.Buffer
+	position := 0
+	for index := uint64(0); ; index++ {
+		if position+36 > len(data) {
+			return nil, fmt.Errorf("the file is truncated")
+		}
+		expected := data[position : position+32]
+		size := int(binary.LittleEndian.Uint32(data[position+32 : position+36]))
+		position += 36
+		if position+size > len(data) {
+			return nil, fmt.Errorf("the file is truncated")
+		}
+		block := data[position : position+size]
+		position += size
+		if !hmac.Equal(expected, kdbxBlockHMAC(hmacKey, index, block)) {
+			return nil, fmt.Errorf("block %v is corrupt", index)
+		}
+		if size == 0 {
+			return payload.Bytes(), nil
+		}
+		payload.Write(block)
+	}
+}
+
+func writeKDBXBlock(out *bytes.Buffer, hmacKey []byte, index uint64, data []byte) {
+	out.Write(kdbxBlockHMAC(hmacKey, index, data))
+	binary.Write(out, binary.LittleEndian, uint32(len(data)))
+	out.Write(data)
+}
+
+func kdbxDecrypt(header kdbxHeader, key []byte, payload []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(header.CipherID, kdbxCipherAES256):
+		if len(payload) == 0 || len(payload)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("the payload is corrupt")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		plain := make([]byte, len(payload))
+		cipher.NewCBCDecrypter(block, header.IV).CryptBlocks(plain, payload)
+		padding := int(plain[len(plain)-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("the payload is corrupt")
+		}
+		return plain[:len(plain)-padding], nil
+	case bytes.Equal(header.CipherID, kdbxCipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, header.IV)
+		if err != nil {
+			return nil, err
+		}
+		plain := make([]byte, len(payload))
+		c.XORKeyStream(plain, payload)
+		return plain, nil
+	}
+	return nil, fmt.Errorf("unsupported cipher (only AES-256 and ChaCha20 are supported)")
+}
+
+func readKDBXInnerHeader(data []byte) (cipher.Stream, []byte, error) {
+	streamID := uint32(0)
+	var streamKey []byte
+	position := 0
+	for {
+		if position+5 > len(data) {
+			return nil, nil, fmt.Errorf("the inner header is truncated")
+		}
+		id := data[position]
+		size := int(binary.LittleEndian.Uint32(data[position+1 : position+5]))
+		position += 5
+		if position+size > len(data) {
+			return nil, nil, fmt.Errorf("the inner header is truncated")
+		}
+		value := data[position : position+size]
+		position += size
+		switch id {
+		case kdbxInnerEnd:
+			stream, err := kdbxInnerStream(streamID, streamKey)
+			return stream, data[position:], err
+		case kdbxInnerStreamID:
+			streamID = binary.LittleEndian.Uint32(value)
+		case kdbxInnerStreamKey:
+			streamKey = value
+		case kdbxInnerBinary:
+			// attachments are not imported
+		}
+	}
+}
+
+func kdbxInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	if id != kdbxStreamChaCha20 {
+		return nil, fmt.Errorf("unsupported protected value stream %v", id)
+	}
+	h := sha512.Sum512(key)
+	return chacha20.NewUnauthenticatedCipher(h[:32], h[32:44])
+}
+
+// kdbxTransformProtected walks the document in order and encrypts (protect)
+// or decrypts the text of every <Value Protected="True">; the inner stream
+// has to be applied in document order
+func kdbxTransformProtected(document []byte, stream cipher.Stream, protect bool) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+	inProtected := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			inProtected = false
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "Protected" && strings.EqualFold(attr.Value, "True") {
+					inProtected = true
+				}
+			}
+		case xml.EndElement:
+			inProtected = false
+		case xml.CharData:
+			if inProtected {
+				var text []byte
+				if protect {
+					encrypted := make([]byte, len(t))
+					stream.XORKeyStream(encrypted, t)
+					text = []byte(base64.StdEncoding.EncodeToString(encrypted))
+				} else {
+					encrypted, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(t)))
+					if err != nil {
+						return nil, fmt.Errorf("a protected value is corrupt")
+					}
+					text = make([]byte, len(encrypted))
+					stream.XORKeyStream(text, encrypted)
+				}
+				token = xml.CharData(text)
+			}
+		}
+		err = encoder.EncodeToken(xml.CopyToken(token))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := encoder.Flush()
+	return out.Bytes(), err
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how KeePass groups become kp entries on import
+const (
+	GROUPS_PREFIX = "prefix" // "Work/AWS" + "root" becomes the key "Work/AWS/root"
+	GROUPS_TAGS   = "tags"   // the key is the title, tagged "Work" and "AWS"
+)
+
+// the standard KeePass fields, and the custom fields kp adds for the DBEntry
+// fields KeePass does not have
+const (
+	KEEPASS_TITLE       = "Title"
+	KEEPASS_USERNAME    = "UserName"
+	KEEPASS_PASSWORD    = "Password"
+	KEEPASS_URL         = "URL"
+	KEEPASS_NOTES       = "Notes"
+	KEEPASS_DESCRIPTION = "Description"
+	KEEPASS_TYPE        = "Type"
+	KEEPASS_HIDDEN      = "Hidden"
+)
+
+var keepassKnownFields = []string{KEEPASS_TITLE, KEEPASS_USERNAME, KEEPASS_PASSWORD, KEEPASS_URL, KEEPASS_NOTES, KEEPASS_DESCRIPTION, KEEPASS_TYPE, KEEPASS_HIDDEN}
+
+// ReadKDBXFile reads the entries of a KDBX 4 file
+func ReadKDBXFile(filename string, password string, groups string) ([]DBEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	keepass, err := ReadKDBX(file, password)
+	if err != nil {
+		return nil, err
+	}
+	return EntriesFromKeePass(keepass, groups, func(key string, field string) {
+		fmt.Fprintf(os.Stderr, "Warning, the protected field '%v' of '%v' was not imported.\n", field, key)
+	}), nil
+}
+
+// WriteKDBXFile writes entries (values in plaintext) to a KDBX 4 file
+func WriteKDBXFile(filename string, entries []DBEntry, password string) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteKDBX(file, KeePassFromEntries(entries), password)
+}
+
+// EntriesFromKeePass converts a KeePass document; the recycle bin and the
+// history are left out. kp has no place for custom fields: they are added
+// to the end of the notes as "Name: value" lines (and so exported that way
+// too), except protected ones, as the notes are not encrypted. Those are
+// passed to skipped (which can be nil).
+func EntriesFromKeePass(file *KeePassFile, groups string, skipped func(key string, field string)) []DBEntry {
+	entries := make([]DBEntry, 0)
+	var walk func(group KeePassGroup, path []string)
+	walk = func(group KeePassGroup, path []string) {
+		if file.Meta.RecycleBinUUID != "" && group.UUID == file.Meta.RecycleBinUUID {
+			return
+		}
+		for _, e := range group.Entries {
+			entries = append(entries, entryFromKeePass(e, path, groups, skipped))
+		}
+		for _, child := range group.Groups {
+			walk(child, append(append([]string{}, path...), child.Name))
+		}
+	}
+	// the top group is the database itself, its name is not part of the path
+	for _, root := range file.Root.Groups {
+		walk(root, []string{})
+	}
+	return entries
+}
+
+func entryFromKeePass(e KeePassEntry, path []string, groups string, skipped func(key string, field string)) DBEntry {
+	title := e.Get(KEEPASS_TITLE)
+	if title == "" {
+		title = "untitled"
+	}
+	entry := DBEntry{
+		Key:         title,
+		Value:       e.Get(KEEPASS_PASSWORD),
+		Username:    e.Get(KEEPASS_USERNAME),
+		Url:         e.Get(KEEPASS_URL),
+		Notes:       e.Get(KEEPASS_NOTES),
+		Description: e.Get(KEEPASS_DESCRIPTION),
+		Type:        e.Get(KEEPASS_TYPE),
+		Hidden:      strings.EqualFold(e.Get(KEEPASS_HIDDEN), "true"),
+		Created:     ParseKDBXTime(e.Times.CreationTime),
+		LastUpdated: ParseKDBXTime(e.Times.LastModificationTime),
+	}
+	tags := strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' })
+	if groups == GROUPS_TAGS {
+		tags = append(tags, path...)
+	} else if len(path) > 0 {
+		entry.Key = strings.Join(path, "/") + "/" + title
+	}
+	for i := range tags {
+		tags[i] = strings.TrimSpace(tags[i])
+	}
+	entry.Tags = tagSet(tags)
+
+	custom := make([]string, 0)
+	for _, s := range e.Strings {
+		if contains(keepassKnownFields, s.Key) || s.Value.Text == "" {
+			continue
+		}
+		if strings.EqualFold(s.Value.Protected, "True") {
+			if skipped != nil {
+				skipped(entry.Key, s.Key)
+			}
+		} else {
+			custom = append(custom, fmt.Sprintf("%v: %v", s.Key, s.Value.Text))
+		}
+	}
+	if len(custom) > 0 {
+		entry.Notes = strings.TrimSpace(entry.Notes + "\n" + strings.Join(custom, "\n"))
+	}
+	return entry
+}
+
+// KeePassFromEntries builds a KeePass document, turning key prefixes into
+// groups ("work/aws/root" is the entry "root" in the group "work/aws")
+func KeePassFromEntries(entries []DBEntry) *KeePassFile {
+	sorted := append([]DBEntry{}, entries...)
+	sort.SliceStable(sorted, func(a int, b int) bool { return sorted[a].Key < sorted[b].Key })
+
+	root := &KeePassGroup{UUID: NewKeePassUUID(), Name: "kp", Times: NewKeePassTimes(time.Time{}, time.Time{})}
+	for _, entry := range sorted {
+		parts := strings.Split(entry.Key, "/")
+		group := root
+		for _, name := range parts[:len(parts)-1] {
+			if name == "" {
+				continue
+			}
+			group = keepassChildGroup(group, name)
+		}
+		group.Entries = append(group.Entries, keepassFromEntry(entry, parts[len(parts)-1]))
+	}
+	return &KeePassFile{
+		Meta: KeePassMeta{Generator: "kp", DatabaseName: "kp", RecycleBinEnabled: "False"},
+		Root: KeePassRoot{Groups: []KeePassGroup{*root}},
+	}
+}
+
+func keepassChildGroup(parent *KeePassGroup, name string) *KeePassGroup {
+	for index := range parent.Groups {
+		if parent.Groups[index].Name == name {
+			return &parent.Groups[index]
+		}
+	}
+	parent.Groups = append(parent.Groups, KeePassGroup{UUID: NewKeePassUUID(), Name: name, Times: NewKeePassTimes(time.Time{}, time.Time{})})
+	return &parent.Groups[len(parent.Groups)-1]
+}
+
+func keepassFromEntry(entry DBEntry, title string) KeePassEntry {
+	e := KeePassEntry{
+		UUID:  NewKeePassUUID(),
+		Tags:  strings.Join(entry.TagList(), ";"),
+		Times: NewKeePassTimes(entry.Created, entry.LastUpdated),
+	}
+	add := func(key string, value string, protected bool) {
+		s := KeePassString{Key: key, Value: KeePassValue{Text: value}}
+		if protected {
+			s.Value.Protected = "True"
+		}
+		e.Strings = append(e.Strings, s)
+	}
+	add(KEEPASS_TITLE, title, false)
+	add(KEEPASS_USERNAME, entry.Username, false)
+	add(KEEPASS_PASSWORD, entry.Value, true)
+	add(KEEPASS_URL, entry.Url, false)
+	add(KEEPASS_NOTES, entry.Notes, false)
+	if entry.Description != "" {
+		add(KEEPASS_DESCRIPTION, entry.Description, false)
+	}
+	if entry.Type != "" {
+		add(KEEPASS_TYPE, entry.Type, false)
+	}
+	if entry.Hidden {
+		add(KEEPASS_HIDDEN, "true", false)
+	}
+	return e
+}
@@ -2,11 +2,11 @@
 package main
 
 import (
-	"crypto/rand"
+	"bufio"
 	"embed"
 	"fmt"
+	"io"
 	"os"
-	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -38,160 +38,33 @@ func main() {
 	cli.Shift() // drop the program name
 	command := cli.GetCommand()
 
-	if graphics_cli || graphics_env {
+	if command == COMPLETE_COMMAND {
+		// called by the shell on every <tab>, so no verification
+		DoComplete(cli)
+	} else if graphics_cli || graphics_env {
 		DoGraphics(cli)
-		return
-	} else if command == "help" {
+	} else if command == "" {
 		DoLogo()
 		DoUsage(cli)
-		return
-	} else if isInfo(command) {
-		DoInfo(cli)
-		return
-	} else if isVerify(command) {
-		result := DoVerify(cli, true)
-		if !result {
-			fmt.Println("KP is NOT setup correctly - failed to verify encryption.")
-			os.Exit(1)
-		} else {
-			fmt.Println("KP is setup correctly.")
-			return
-		}
-	}
-
-	result := DoVerify(cli, false)
-	if !result {
-		fmt.Println("Failed to verify encryption.")
-		fmt.Println("")
-		fmt.Println("Run 'kp verify' for details, or create an encryption key with:")
-		fmt.Println("")
-		keyFile := os.Getenv(KP_KEY)
-		if keyFile == "" {
-			keyFile = DEFAULT_KEY_FILE
-		}
-		fmt.Printf("    %v\n", GetSSHCommand(keyFile))
-		fmt.Println("")
-		os.Exit(1)
-	}
-
-	if isList(command) {
-		searchTerm := cli.GetStringOrDefault(command, "")
-		if searchTerm == "-a" {
-			searchTerm = cli.GetStringOrDefault(searchTerm, "")
-		}
-		DoList(cli, searchTerm)
-	} else if isHide(command) {
-		DoHide(cli)
-	} else if isShow(command) {
-		DoShow(cli)
-	} else if isOpen(command) {
-		DoOpen(cli)
-	} else if isVersion(command) {
-		DoVersion(cli)
-	} else if isPut(command, cli) {
-		DoPut(cli)
-	} else if isRandom(command, cli) {
-		DoRandom(cli)
-	} else if isEncrypt(command) {
-		DoEncrypt(cli)
-	} else if isDecrypt(command) {
-		DoDecrypt(cli)
-	} else if isUpdate(command) {
-		DoUpdate(cli)
-	} else if isTag(command) {
-		DoTag(cli)
-	} else if isUntag(command) {
-		DoUntag(cli)
-	} else if isRename(command) {
-		DoRename(cli)
-	} else if isGet(command, cli) {
-		DoGet(cli)
-	} else if isDelete(command) {
-		DoDelete(cli)
-	} else if command != "" {
-		fmt.Printf("kp %v: unknown command\n", command)
-		fmt.Printf("Run 'kp help' for usage.\n")
-		os.Exit(1)
 	} else {
-		DoLogo()
-		DoUsage(cli)
+		RunCommand(cli)
 	}
 }
 
-func isVerify(command string) bool {
-	return command == "verify"
-}
-
-func isEncrypt(command string) bool {
-	return command == "encrypt"
-}
-
-func isDecrypt(command string) bool {
-	return command == "decrypt"
-}
-
-func isInfo(command string) bool {
-	return command == "info"
-}
-
-func isDelete(command string) bool {
-	return command == "rm"
-}
-
-func isUpdate(command string) bool {
-	return command == "update"
-}
-
-func isTag(command string) bool {
-	return command == "tag"
-}
-
-func isUntag(command string) bool {
-	return command == "untag"
-}
-
-func isRename(command string) bool {
-	return command == "rename"
-}
-
-func isVersion(command string) bool {
-	return command == "version"
-}
-
-func isOpen(command string) bool {
-	return command == "open"
-}
-
-func isList(command string) bool {
-	return command == "ls" || command == "list"
-}
-
-func isHide(command string) bool {
-	return command == "hide"
-}
-
-func isShow(command string) bool {
-	return command == "show"
-}
-
-// A 'get' is basically not a a list, delete or a put
-func isGet(command string, c *cli.CLI) bool {
-	return command == "get"
-}
-
-func isPut(command string, c *cli.CLI) bool {
-	return command == "put"
-}
-
-func isRandom(command string, c *cli.CLI) bool {
-	return command == "random"
-}
-
+// DoGraphics runs the TUI; "kp ls <query> -g" shows only the matching entries
 func DoGraphics(c *cli.CLI) {
 	filename := cli.GetEnvOrDefault(KP_FILE, DEFAULT_DB_FILE)
 	privKey := cli.GetEnvOrDefault(KP_KEY, DEFAULT_KEY_FILE)
 	db := NewKPDB(filename, privKey)
 	gui := NewGUI(db)
+	if cmd := FindCommand(c.GetCommand()); cmd != nil && cmd.Name == "ls" {
+		query, err := ParseQuery(strings.Join(Positionals(c), " "), time.Now())
+		if err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		gui.Query = query
+	}
 	gui.Run()
 }
 
@@ -271,6 +144,16 @@ func DoVerify(c *cli.CLI, printFailuresToStdOut bool) bool {
 	return overallValid
 }
 
+// DoVerifyCommand is "kp verify", printing the details of any failure
+func DoVerifyCommand(c *cli.CLI) {
+	result := DoVerify(c, true)
+	if !result {
+		fmt.Println("KP is NOT setup correctly - failed to verify encryption.")
+		os.Exit(1)
+	}
+	fmt.Println("KP is setup correctly.")
+}
+
 func DoLogo() {
 	f := figure.NewColorFigure("kp", "", "blue", true)
 	f.Print()
@@ -293,87 +176,169 @@ func DoInfo(c *cli.CLI) {
 
 func DoGet(c *cli.CLI) {
 	command := c.GetCommand()
-	key := c.GetStringOrDie(command)
+	key := c.GetStringOrDefault(command, "")
+	if key == "" {
+		Fail(c, ERR_USAGE, "Usage: kp get [key]")
+	}
 	db := LoadDB()
 	entry, exists := db.GetDecrypted(key)
-	if exists {
-		value := entry.Value
-		if c.IndexOf("-stdout") > -1 {
-			fmt.Printf("%v\n", value)
+	if !exists {
+		Fail(c, ERR_NOT_FOUND, "'%v' does not exist.", key)
+	}
+	value := entry.Value
+	WarnIfOverdue(db, entry)
+	if IsJSON(c) {
+		PrintJSON(c, NewEntryJSON(entry, true))
+	} else if HasFlag(c, "-stdout") {
+		fmt.Printf("%v\n", value)
+	} else {
+		err := clipboard.WriteAll(value)
+		if err != nil {
+			fmt.Printf("%v", err)
 		} else {
-			err := clipboard.WriteAll(value)
-			if err != nil {
-				fmt.Printf("%v", err)
-			} else {
-				DoDescribe(c)
-			}
+			DoDescribe(c)
 		}
-	} else {
-		fmt.Printf("'%v' does not exist.\n", key)
-		os.Exit(1)
 	}
 }
 
 func DoPut(c *cli.CLI) {
 	db := LoadDB()
 	command := c.GetCommand()
-	prompt := c.GetStringOrDefault("-prompt", "")
-	if prompt != "" {
-		fmt.Print(prompt + " : ")
-	}
 	key := c.GetStringOrDie(command)
 	if len(key) > 125 {
 		fmt.Printf("Error, key must be <= 125 characters.\n")
 		os.Exit(1)
 	} else if len(key) == 0 {
-		fmt.Print("Usage: kp put [key] \n\t-url url\n\t-description <description>\n\t-type <type>\n\t-note <notes>\n\t-username <username>\n")
+		fmt.Print(CommandUsage(FindCommand("put")))
 		os.Exit(1)
 	}
 
-	defaultValue := c.GetStringOrDefault("-default", "")
+	defaultValue := FlagString(c, "-default", "")
 
-	noOverwrite := c.Contains("-no-overwrite")
+	noOverwrite := HasFlag(c, "-no-overwrite")
 	entry, exists := db.GetDecrypted(key)
 	if noOverwrite && exists {
 		fmt.Printf("Error, '%v' already exists.\n", key)
 		os.Exit(1)
 	}
 	entry.Key = key
-	entry.Description = c.GetStringOrDefault("-description", entry.Description)
-	entry.Type = c.GetStringOrDefault("-type", entry.Type)
-	entry.Notes = c.GetStringOrDefault("-note", entry.Notes)
-	entry.Url = c.GetStringOrDefault("-url", entry.Url)
-	entry.Username = c.GetStringOrDefault("-username", entry.Username)
+	entry.Description = FlagString(c, "-description", entry.Description)
+	entry.Type = FlagString(c, "-type", entry.Type)
+	entry.Notes = FlagString(c, "-notes", FlagString(c, "-note", entry.Notes))
+	entry.Url = FlagString(c, "-url", entry.Url)
+	entry.Username = FlagString(c, "-username", entry.Username)
 
 	password := ""
-	if c.IndexOf("-value") > -1 {
-		password = c.GetStringOrDefault("-value", "")
+	if HasFlag(c, "-value") {
+		password = FlagString(c, "-value", "")
 		if password == "" {
-			fmt.Printf("Error, -value cannot be empty.")
+			fmt.Printf("Error, -value cannot be empty.\n")
 			os.Exit(1)
 		}
-	} else if c.IndexOf("-random") > -1 {
-		randomSize := c.GetIntOrDefault("-random", 64)
-		password, _ = CreatePassword(randomSize)
+	} else if HasFlag(c, "-passphrase") {
+		passphrase, entropy := GeneratePassphraseFromFlags(c, FlagInt(c, "-passphrase", DEFAULT_PASSPHRASE_WORDS))
+		fmt.Fprintf(os.Stderr, "%.1f bits of entropy\n", entropy)
+		password = passphrase
+	} else if HasFlag(c, "-random") || HasFlag(c, "-policy") {
+		password = GeneratePassword(c, FlagInt(c, "-random", 0))
 	} else {
-		bytePassword, _ := terminal.ReadPassword(int(syscall.Stdin))
-		password = string(bytePassword)
+		value, err := ReadValue(c)
+		if err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		password = value
 	}
 
 	if password != "" {
 		entry.Value = password
 	} else if defaultValue != "" {
 		entry.Value = defaultValue
+	} else {
+		fmt.Printf("Error, no value entered for '%v' (use -default to provide one).\n", key)
+		os.Exit(1)
 	}
 
 	db.Put(entry)
 	db.Save()
 }
 
+// ReadValue reads the value for a put from -file, from stdin when it is a
+// pipe or file (all of it, as-is), or from the terminal where it is asked
+// for twice to catch typos
+func ReadValue(c *cli.CLI) (string, error) {
+	if HasFlag(c, "-file") {
+		filename := FlagString(c, "-file", "")
+		if filename == "" {
+			return "", fmt.Errorf("-file requires a filename")
+		}
+		data, err := os.ReadFile(goutils.EvaluateFilename(filename))
+		return string(data), err
+	}
+
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+
+	return ReadTerminal(FlagString(c, "-prompt", "Value"), true)
+}
+
+// ReadPassphrase reads the passphrase of an import or export file from the
+// terminal (twice when confirm is set), or the first line of stdin. It is
+// never empty.
+func ReadPassphrase(prompt string, confirm bool) (string, error) {
+	var passphrase string
+	var err error
+	if terminal.IsTerminal(int(syscall.Stdin)) {
+		passphrase, err = ReadTerminal(prompt, confirm)
+	} else {
+		passphrase, err = readLine(os.Stdin)
+	}
+	if err == nil && passphrase == "" {
+		err = fmt.Errorf("no passphrase entered")
+	}
+	return passphrase, err
+}
+
+// readLine reads the first line of r without its line ending
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadTerminal reads a secret without echoing it, asking twice when confirm
+// is set so a typo is caught
+func ReadTerminal(prompt string, confirm bool) (string, error) {
+	fmt.Print(prompt + " : ")
+	first, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil || len(first) == 0 || !confirm {
+		return string(first), err
+	}
+	fmt.Print(strings.Repeat(" ", goutils.Max(len(prompt)-len("Confirm"), 0)) + "Confirm : ")
+	second, err := terminal.ReadPassword(int(syscall.Stdin))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", fmt.Errorf("the values entered do not match")
+	}
+	return string(first), nil
+}
+
 func DoRandom(c *cli.CLI) {
-	size := c.GetIntOrDefault("random", 64)
-	password, _ := CreatePassword(size)
-	fmt.Println(password)
+	if HasFlag(c, "-words") {
+		passphrase, entropy := GeneratePassphraseFromFlags(c, FlagInt(c, "-words", DEFAULT_PASSPHRASE_WORDS))
+		fmt.Println(passphrase)
+		fmt.Fprintf(os.Stderr, "%.1f bits of entropy\n", entropy)
+		return
+	}
+	fmt.Println(GeneratePassword(c, c.GetIntOrDefault("random", 0)))
 }
 
 func DoUpdate(c *cli.CLI) {
@@ -381,7 +346,7 @@ func DoUpdate(c *cli.CLI) {
 	command := c.GetCommand()
 	key := c.GetStringOrDie(command)
 	if key == "" {
-		fmt.Print("Usage: kp update [key] \n\t-url url\n\t-description <description>\n\t-type <type>\n\t-note <notes>\n\t-username <username>\n")
+		fmt.Print(CommandUsage(FindCommand("update")))
 		os.Exit(1)
 	}
 	entry, exists := db.GetDecrypted(key)
@@ -389,11 +354,11 @@ func DoUpdate(c *cli.CLI) {
 		fmt.Printf("%v does not exist.\n", key)
 		os.Exit(1)
 	}
-	entry.Description = c.GetStringOrDefault("-description", entry.Description)
-	entry.Type = c.GetStringOrDefault("-type", entry.Type)
-	entry.Notes = c.GetStringOrDefault("-note", entry.Notes)
-	entry.Url = c.GetStringOrDefault("-url", entry.Url)
-	entry.Username = c.GetStringOrDefault("-username", entry.Username)
+	entry.Description = FlagString(c, "-description", entry.Description)
+	entry.Type = FlagString(c, "-type", entry.Type)
+	entry.Notes = FlagString(c, "-notes", FlagString(c, "-note", entry.Notes))
+	entry.Url = FlagString(c, "-url", entry.Url)
+	entry.Username = FlagString(c, "-username", entry.Username)
 	db.Put(entry)
 	db.Save()
 }
@@ -418,33 +383,30 @@ func DoOpen(c *cli.CLI) {
 
 }
 
+// DoTag tags a key, or every key under a namespace such as work/aws/
 func DoTag(c *cli.CLI) {
 	db := LoadDB()
 	command := c.GetCommand()
 	key := c.GetStringOrDie(command)
-	tag := c.GetStringOrDie(key)
-	entry, exists := db.GetDecrypted(key)
-	if !exists {
-		fmt.Printf("%v does not exist.\n", key)
+	tag, err := NormalizeTag(c.GetStringOrDie(key))
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
 		os.Exit(1)
 	}
-	if entry.Tags == nil {
-		entry.Tags = make(map[string]bool)
-	}
-	entry.Tags[tag] = true
-	db.Put(entry)
-	db.Save()
-
+	updateAndSave(db, key, func(entry *DBEntry) {
+		tags := map[string]bool{tag: true}
+		for t, on := range entry.Tags {
+			tags[t] = on
+		}
+		entry.Tags = tags
+	})
 }
 
 func DoHide(c *cli.CLI) {
 	db := LoadDB()
 	command := c.GetCommand()
 	key := c.GetStringOrDie(command)
-	entry, _ := db.GetDecrypted(key)
-	entry.Hidden = true
-	db.Put(entry)
-	db.Save()
+	updateAndSave(db, key, func(entry *DBEntry) { entry.Hidden = true })
 }
 
 func DoUntag(c *cli.CLI) {
@@ -452,22 +414,29 @@ func DoUntag(c *cli.CLI) {
 	command := c.GetCommand()
 	key := c.GetStringOrDie(command)
 	tag := c.GetStringOrDie(key)
-	entry, _ := db.GetDecrypted(key)
-	if entry.Tags == nil {
-		entry.Tags = make(map[string]bool)
-	}
-	delete(entry.Tags, tag)
-	db.Put(entry)
-	db.Save()
-
+	updateAndSave(db, key, func(entry *DBEntry) {
+		tags := make(map[string]bool)
+		for t, on := range entry.Tags {
+			tags[t] = on
+		}
+		delete(tags, entry.findTag(tag))
+		entry.Tags = tags
+	})
 }
+
 func DoShow(c *cli.CLI) {
 	db := LoadDB()
 	command := c.GetCommand()
 	key := c.GetStringOrDie(command)
-	entry, _ := db.GetDecrypted(key)
-	entry.Hidden = false
-	db.Put(entry)
+	updateAndSave(db, key, func(entry *DBEntry) { entry.Hidden = false })
+}
+
+// updateAndSave applies update to the key (or namespace) and saves the db
+func updateAndSave(db *KPDB, key string, update func(entry *DBEntry)) {
+	if _, err := UpdateEntries(db, key, update); err != nil {
+		fmt.Printf("Error, %v.\n", err)
+		os.Exit(1)
+	}
 	db.Save()
 }
 
@@ -496,76 +465,119 @@ func DoRename(c *cli.CLI) {
 func DoDescribe(c *cli.CLI) {
 	db := LoadDB()
 	command := c.GetCommand()
-	key := c.GetStringOrDie(command)
+	key := c.GetStringOrDefault(command, "")
+	if key == "" {
+		Fail(c, ERR_USAGE, "Usage: kp describe [key]")
+	}
 	entry, exists := db.GetDecrypted(key)
-	if exists {
-		fmt.Printf("Key          : %v\n", entry.Key)
-		fmt.Printf("Description  : %v\n", entry.Description)
-		fmt.Printf("Username     : %v\n", entry.Username)
-		fmt.Printf("Url          : %v\n", entry.Url)
-		fmt.Printf("Created      : %v\n", entry.Created.Format(time.RFC822))
-		fmt.Printf("Last Updated : %v\n", entry.LastUpdated.Format(time.RFC822))
-		fmt.Printf("Type         : %v\n", entry.Type)
-		fmt.Printf("Notes        : %v\n", entry.Notes)
-	} else {
-		fmt.Printf("Error, no entry '%v'\n", entry.Key)
+	if !exists {
+		Fail(c, ERR_NOT_FOUND, "Error, no entry '%v'", key)
+	}
+	if IsJSON(c) {
+		PrintJSON(c, NewEntryJSON(entry, false))
+		return
 	}
+	fmt.Printf("Key          : %v\n", entry.Key)
+	fmt.Printf("Description  : %v\n", entry.Description)
+	fmt.Printf("Username     : %v\n", entry.Username)
+	fmt.Printf("Url          : %v\n", entry.Url)
+	fmt.Printf("Created      : %v\n", entry.Created.Format(time.RFC822))
+	fmt.Printf("Last Updated : %v\n", entry.LastUpdated.Format(time.RFC822))
+	fmt.Printf("Type         : %v\n", entry.Type)
+	fmt.Printf("Tags         : %v\n", strings.Join(entry.TagList(), ", "))
+	if status, ok := db.GetData().RotationOf(entry, time.Now()); ok {
+		fmt.Printf("Rotation     : every %v (%v), %v\n", pluralDays(status.Days), status.Rule, status.Describe())
+	}
+	fmt.Printf("Notes        : %v\n", entry.Notes)
 
 }
 
 func DoList(c *cli.CLI, searchTerm string) {
 	db := LoadDB()
 	data := db.GetData()
-	includeHidden := c.IndexOf("-a") > -1
+	includeHidden := HasFlag(c, "-a")
 
-	if len(data.Entries) == 0 {
+	if len(data.Entries) == 0 && !IsJSON(c) {
 		fmt.Printf("DB is empty.\n")
 		return
 	}
 
-	// terminalWidth, terminalHeight, _ := terminal.GetSize(0)
+	// a namespace (work/aws/) lists the keys under it
+	namespace := ""
+	if IsNamespace(searchTerm) {
+		namespace, searchTerm = searchTerm, ""
+	}
 
-	keys := make([]string, 0)
-	max_key := len("Key") + 1
-	max_url := len("Url") + 1
-	max_username := len("Username") + 1
-	max_type := len("Type") + 1
-	max_description := len("Description") + 1
-	max_notes := len("Notes") + 1
+	// a query (tag:prod updated<90d ...) filters the entries; it can ask
+	// for hidden ones itself
+	query, _ := ParseQuery("", time.Now())
+	if IsQuery(searchTerm) {
+		parsed, err := ParseQuery(searchTerm, time.Now())
+		if err != nil {
+			Fail(c, ERR_USAGE, "Error, %v", err)
+		}
+		query = parsed
+		includeHidden = includeHidden || query.Hidden
+		searchTerm = ""
+	}
 
-	for key, entry := range data.Entries {
-		if !includeHidden && entry.Hidden {
-			continue
+	// -tag work,prod keeps the entries with all of the tags
+	tags := make([]string, 0)
+	if HasFlag(c, "-tag") {
+		for _, tag := range strings.Split(FlagString(c, "-tag", ""), ",") {
+			normalized, err := NormalizeTag(tag)
+			if err != nil {
+				Fail(c, ERR_USAGE, "Error, %v", err)
+			}
+			tags = append(tags, normalized)
+		}
+	}
+	hasTags := func(entry DBEntry) bool {
+		for _, tag := range tags {
+			if !entry.HasTag(tag) {
+				return false
+			}
 		}
-		keys = append(keys, key)
-		max_key = goutils.Max(len(entry.Key)+1, max_key)
-		max_username = goutils.Max(len(entry.Username)+1, max_username)
-		max_type = goutils.Max(len(entry.Type)+1, max_type)
+		return true
 	}
-	sort.Strings(keys)
 
-	date_width := len(time.Now().Format(time.RFC822)) + 1
-	width := max_key + max_url + max_username + max_type + max_description + max_notes + (1 * date_width) + 8
-	line := strings.Repeat("-", width)
 	foundEntries := make([]DBEntry, 0)
-
 	for _, entry := range db.GetEntriesSortedByUpdatedThenKey() {
 		if !includeHidden && entry.Hidden {
 			continue
 		}
+		if strings.HasPrefix(entry.Key, namespace) && query.Match(entry) && hasTags(entry) {
+			foundEntries = append(foundEntries, entry)
+		}
+	}
 
-		if searchTerm != "" {
-			found := strings.Contains(entry.Key, searchTerm)
-			found = found || strings.Contains(entry.Description, searchTerm)
-			found = found || strings.Contains(entry.Notes, searchTerm)
-			found = found || strings.Contains(entry.Type, searchTerm)
-			found = found || strings.Contains(entry.Username, searchTerm)
-			found = found || strings.Contains(entry.Url, searchTerm)
-			if !found {
-				continue
-			}
+	// a search term orders the entries by how well they match (unless
+	// -sort is given, -reverse puts the best last), and the matched
+	// characters are highlighted
+	matches := make(map[string]SearchResult)
+	if searchTerm != "" {
+		results := SearchEntries(foundEntries, searchTerm, HasFlag(c, "-case-sensitive"))
+		foundEntries = make([]DBEntry, 0)
+		for _, result := range results {
+			foundEntries = append(foundEntries, result.Entry)
+			matches[result.Entry.Key] = result
 		}
-		foundEntries = append(foundEntries, entry)
+	}
+	sortBy := FlagString(c, "-sort", "")
+	if sortBy == "" && searchTerm == "" {
+		sortBy = "key"
+	}
+	if err := SortEntries(foundEntries, sortBy, HasFlag(c, "-reverse")); err != nil {
+		Fail(c, ERR_USAGE, "Error, %v", err)
+	}
+
+	if IsJSON(c) {
+		results := make([]EntryJSON, 0)
+		for _, entry := range foundEntries {
+			results = append(results, NewEntryJSON(entry, false))
+		}
+		PrintJSONList(c, results)
+		return
 	}
 
 	if len(foundEntries) == 0 {
@@ -573,47 +585,92 @@ func DoList(c *cli.CLI, searchTerm string) {
 		return
 	}
 
-	entry_line := fmt.Sprintf("|%v|%v|%v|%v|%v|%v|%v|",
-		goutils.RPadToFixedLength("Key", " ", max_key),
-		goutils.RPadToFixedLength("Username", " ", max_username),
-		goutils.RPadToFixedLength("Url", " ", max_url),
-		goutils.RPadToFixedLength("Type", " ", max_type),
-		goutils.RPadToFixedLength("Description", " ", max_description),
-		goutils.RPadToFixedLength("Notes", " ", max_notes),
-		goutils.RPadToFixedLength("Updated", " ", date_width))
-	fmt.Println(line)
-	fmt.Println(entry_line)
-	fmt.Println(line)
+	// the table fits the terminal; narrow ones (or -compact) get fewer
+	// columns, short dates and no borders
+	isTerminal := terminal.IsTerminal(int(syscall.Stdout))
+	terminalWidth := 0
+	if isTerminal {
+		terminalWidth, _, _ = terminal.GetSize(int(syscall.Stdout))
+	}
+	compact := HasFlag(c, "-compact") || (terminalWidth > 0 && terminalWidth < LIST_COMPACT_WIDTH)
+	dates := time.RFC822
+	names := strings.Join(LIST_DEFAULT_COLUMNS, ",")
+	if compact {
+		dates = "2006-01-02"
+		names = strings.Join(LIST_COMPACT_COLUMNS, ",")
+	}
+	// entries with a rotation interval get a due column, marking the
+	// overdue ones
+	now := time.Now()
+	rotations := make(map[string]*RotationStatus)
 	for _, entry := range foundEntries {
-		updated := entry.LastUpdated.Format(time.RFC822)
-
-		url := ""
-		if entry.Url != "" {
-			url = "... "
+		if status, ok := data.RotationOf(entry, now); ok {
+			rotations[entry.Key] = &status
 		}
+	}
+	if len(rotations) > 0 {
+		names += "," + LIST_DUE_COLUMN
+	}
+	columns, err := ParseListColumns(FlagString(c, "-columns", names))
+	if err != nil {
+		Fail(c, ERR_USAGE, "Error, %v", err)
+	}
 
-		description := ""
-		if entry.Description != "" {
-			description = "... "
+	cells := make([][]string, 0)
+	header := make([]string, 0)
+	fixed := make([]bool, 0)
+	for _, column := range columns {
+		header = append(header, column.Header)
+		fixed = append(fixed, column.Fixed)
+	}
+	cells = append(cells, header)
+	for _, entry := range foundEntries {
+		row := make([]string, 0)
+		for _, column := range columns {
+			row = append(row, singleLine(column.Value(entry, ListRow{dates, rotations[entry.Key]})))
 		}
-
-		notes := ""
-		if entry.Notes != "" {
-			notes = "... "
+		cells = append(cells, row)
+	}
+
+	separator, left, right := "|", "|", "|"
+	if compact {
+		separator, left, right = "  ", "", ""
+	}
+	separators := len(left) + len(right) + len(separator)*(len(columns)-1)
+	widths := FitColumns(cells, fixed, separators, terminalWidth)
+	total := separators
+	for _, width := range widths {
+		total += width
+	}
+	line := strings.Repeat("-", total)
+
+	for index, row := range cells {
+		fitted := make([]string, 0)
+		for i, cell := range row {
+			text := FitCell(cell, widths[i])
+			if index > 0 && isTerminal {
+				entry := foundEntries[index-1]
+				match, found := matches[entry.Key]
+				if found && match.Field == columns[i].Name {
+					// the positions are in the field before it was made
+					// one line and fitted to the column
+					raw, _ := EntryField(entry, match.Field)
+					text = HighlightCell(raw, match.Positions, widths[i], HIGHLIGHT_ON, HIGHLIGHT_OFF)
+				}
+			}
+			fitted = append(fitted, text)
 		}
-
-		entry_line := fmt.Sprintf("|%v|%v|%v|%v|%v|%v|%v|",
-			goutils.RPadToFixedLength(entry.Key, " ", max_key),
-			goutils.RPadToFixedLength(entry.Username, " ", max_username),
-			goutils.RPadToFixedLength(url, " ", max_url),
-			goutils.RPadToFixedLength(entry.Type, " ", max_type),
-			goutils.RPadToFixedLength(description, " ", max_description),
-			goutils.RPadToFixedLength(notes, " ", max_notes),
-			goutils.RPadToFixedLength(updated, " ", date_width))
-		fmt.Println(entry_line)
-
+		if !compact && index == 0 {
+			fmt.Println(line)
+		}
+		fmt.Println(strings.TrimRight(left+strings.Join(fitted, separator)+right, " "))
+		if !compact && index == 0 {
+			fmt.Println(line)
+		}
+	}
+	if !compact {
+		fmt.Println(line)
 	}
-	fmt.Println(line)
 
 }
 
@@ -637,7 +694,7 @@ func DoDelete(c *cli.CLI) {
 }
 
 func DoUsage(c *cli.CLI) {
-	fmt.Print(GLOBAL_USAGE)
+	fmt.Print(Usage())
 }
 
 func DoVersion(c *cli.CLI) {
@@ -705,37 +762,3 @@ func Findfile(filename string, VERBOSE bool) string {
 	}
 
 }
-
-const AllowedChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()-_=+[]{}|;:,.<>?/"
-
-func CreatePassword(length int) (string, error) {
-	if length <= 0 {
-		return "", fmt.Errorf("invalid password length")
-	}
-
-	charPool := []rune(AllowedChars)
-	password := make([]rune, length)
-
-	for i := range password {
-		randomIndex, err := randomInt(len(charPool))
-		if err != nil {
-			return "", err
-		}
-		password[i] = charPool[randomIndex]
-	}
-
-	return string(password), nil
-}
-
-func randomInt(max int) (int, error) {
-	b := make([]byte, 1)
-	for {
-		_, err := rand.Read(b)
-		if err != nil {
-			return 0, err
-		}
-		if int(b[0]) < 256-(256%max) {
-			return int(b[0]) % max, nil
-		}
-	}
-}
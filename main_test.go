@@ -1,8 +1,13 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	cli "github.com/simonski/cli"
@@ -23,3 +28,36 @@ func TestMain(t *testing.T) {
 	}
 
 }
+
+// newTestDB returns an empty KPDB backed by a temporary file and a freshly
+// generated RSA key
+func newTestDB(t *testing.T) *KPDB {
+	t.Helper()
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "kp.id_rsa")
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKPDB(filepath.Join(dir, "kpfile"), keyFile)
+}
+
+func TestReadPassphraseFromStdin(t *testing.T) {
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	for input, expected := range map[string]string{"secret\r\n": "secret", "": "", "\n": ""} {
+		file := filepath.Join(t.TempDir(), "stdin")
+		os.WriteFile(file, []byte(input), 0600)
+		os.Stdin, _ = os.Open(file)
+		passphrase, err := ReadPassphrase("Passphrase", false)
+		os.Stdin.Close()
+		if passphrase != expected || (expected == "") != (err != nil) {
+			t.Errorf("ReadPassphrase(%q) = %q, %v", input, passphrase, err)
+		}
+	}
+}
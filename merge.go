@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+	terminal "golang.org/x/term"
+)
+
+// how an entry changed in both vaults is resolved
+const (
+	MERGE_OURS   = "ours"
+	MERGE_THEIRS = "theirs"
+	MERGE_NEWEST = "newest"
+	MERGE_BOTH   = "both" // theirs is kept under a suffixed key
+)
+
+var MERGE_STRATEGIES = []string{MERGE_OURS, MERGE_THEIRS, MERGE_NEWEST, MERGE_BOTH}
+
+// mergePolicies maps a strategy onto the import conflict policy that applies it
+var mergePolicies = map[string]string{
+	MERGE_OURS:   CONFLICT_SKIP,
+	MERGE_THEIRS: CONFLICT_OVERWRITE,
+	MERGE_NEWEST: CONFLICT_NEWEST,
+	MERGE_BOTH:   CONFLICT_SUFFIX,
+}
+
+// MergeConflict is a key whose entry differs in both vaults
+type MergeConflict struct {
+	Ours   DBEntry
+	Theirs DBEntry
+}
+
+// MergePlan is the outcome of comparing two vaults (values in plaintext)
+type MergePlan struct {
+	Changes   []DBEntry // entries to take from theirs as they are
+	Conflicts []MergeConflict
+	Deletions []string // our keys they deleted
+	Unchanged int
+
+	Deleted map[string]time.Time // their deletions, kept by the merge
+}
+
+// PlanMerge compares the vaults by key. The copies were last in sync no
+// earlier than the newest entry they still agree on; an entry that differs
+// and was only updated after that point on one side takes that side,
+// otherwise both changed it and it is a conflict. An entry one side deleted
+// stays deleted unless the other side updated it after the deletion.
+func PlanMerge(ours []DBEntry, theirs []DBEntry, ourDeleted map[string]time.Time, theirDeleted map[string]time.Time) MergePlan {
+	plan := MergePlan{Changes: make([]DBEntry, 0), Conflicts: make([]MergeConflict, 0), Deletions: make([]string, 0), Deleted: theirDeleted}
+	ourEntries := make(map[string]DBEntry)
+	for _, e := range ours {
+		ourEntries[e.Key] = e
+	}
+	theirEntries := make(map[string]DBEntry)
+	for _, e := range theirs {
+		theirEntries[e.Key] = e
+	}
+	for _, o := range ours {
+		deleted, exists := theirDeleted[o.Key]
+		if _, kept := theirEntries[o.Key]; exists && !kept && !deleted.Before(o.LastUpdated) {
+			plan.Deletions = append(plan.Deletions, o.Key)
+		}
+	}
+
+	var synced time.Time
+	for _, e := range theirs {
+		if o, exists := ourEntries[e.Key]; exists && SameEntry(o, e) && o.LastUpdated.Equal(e.LastUpdated) && o.LastUpdated.After(synced) {
+			synced = o.LastUpdated
+		}
+	}
+
+	for _, t := range theirs {
+		o, exists := ourEntries[t.Key]
+		deleted, wasDeleted := ourDeleted[t.Key]
+		switch {
+		case !exists && wasDeleted && !deleted.Before(t.LastUpdated):
+			continue
+		case !exists:
+			plan.Changes = append(plan.Changes, t)
+		case SameEntry(o, t):
+			plan.Unchanged++
+		case !o.LastUpdated.After(synced) && o.Created.Equal(t.Created):
+			plan.Changes = append(plan.Changes, t)
+		case !t.LastUpdated.After(synced) && o.Created.Equal(t.Created):
+			plan.Unchanged++
+		default:
+			plan.Conflicts = append(plan.Conflicts, MergeConflict{Ours: o, Theirs: t})
+		}
+	}
+	return plan
+}
+
+// SameEntry is true when the entries hold the same value and metadata
+func SameEntry(a DBEntry, b DBEntry) bool {
+	return len(DiffFields(a, b)) == 0
+}
+
+// DiffFields lists the fields that differ between two entries
+func DiffFields(a DBEntry, b DBEntry) []string {
+	fields := make([]string, 0)
+	check := func(name string, x string, y string) {
+		if x != y {
+			fields = append(fields, name)
+		}
+	}
+	check("value", a.Value, b.Value)
+	check("description", a.Description, b.Description)
+	check("notes", a.Notes, b.Notes)
+	check("username", a.Username, b.Username)
+	check("url", a.Url, b.Url)
+	check("type", a.Type, b.Type)
+	check("tags", strings.Join(a.TagList(), ","), strings.Join(b.TagList(), ","))
+	check("hidden", fmt.Sprint(a.Hidden), fmt.Sprint(b.Hidden))
+	check("rotateDays", fmt.Sprint(a.RotateDays), fmt.Sprint(b.RotateDays))
+	return fields
+}
+
+// ApplyMerge stores the plan in the db; resolve picks the strategy for
+// each conflict. The db is not saved.
+func ApplyMerge(db *KPDB, plan MergePlan, resolve func(MergeConflict) string, dryRun bool) ImportSummary {
+	summary := ImportEntries(db, plan.Changes, CONFLICT_OVERWRITE, dryRun)
+	for _, conflict := range plan.Conflicts {
+		policy := mergePolicies[resolve(conflict)]
+		resolved := ImportEntries(db, []DBEntry{conflict.Theirs}, policy, dryRun)
+		summary.Actions = append(summary.Actions, resolved.Actions...)
+	}
+	for _, key := range plan.Deletions {
+		summary.Actions = append(summary.Actions, ImportAction{Action: IMPORT_DELETE, Key: key})
+	}
+	if dryRun {
+		return summary
+	}
+
+	data := db.GetData()
+	for _, key := range plan.Deletions {
+		delete(data.Entries, key)
+	}
+	for key, deleted := range plan.Deleted {
+		if _, exists := data.Entries[key]; exists || !deleted.After(data.Deleted[key]) {
+			continue
+		}
+		if data.Deleted == nil {
+			data.Deleted = make(map[string]time.Time)
+		}
+		data.Deleted[key] = deleted
+	}
+	return summary
+}
+
+// decryptEntries decrypts every entry, failing (rather than exiting) when
+// the key cannot
+func decryptEntries(db *KPDB) ([]DBEntry, error) {
+	entries := make([]DBEntry, 0)
+	for _, e := range db.GetEntriesSortedByUpdatedThenKey() {
+		value, err := db.Decrypt(e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt '%v' in %v with %v", e.Key, db.Filename, db.PrivateKeyFilename)
+		}
+		e.Value = value
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// DoMerge is "kp merge <other.kpfile>"
+func DoMerge(c *cli.CLI) {
+	filename := goutils.EvaluateFilename(Positionals(c)[0])
+	strategy := FlagString(c, "-strategy", "")
+	if strategy != "" && !contains(MERGE_STRATEGIES, strategy) {
+		fmt.Printf("Error, -strategy must be one of %v.\n", MERGE_STRATEGIES)
+		os.Exit(1)
+	}
+	dryRun := HasFlag(c, "-dry-run")
+	if !goutils.FileExists(filename) {
+		fmt.Printf("Error, %v does not exist.\n", filename)
+		os.Exit(1)
+	}
+
+	db := LoadDB()
+	other := NewKPDB(filename, FlagString(c, "-key", db.PrivateKeyFilename))
+	ours, err := decryptEntries(db)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	theirs, err := decryptEntries(other)
+	if err != nil {
+		fmt.Printf("Error, %v (use -key for a vault with a different key)\n", err)
+		os.Exit(1)
+	}
+
+	plan := PlanMerge(ours, theirs, db.GetData().Deleted, other.GetData().Deleted)
+	resolve, err := MergeResolver(plan, strategy)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	summary := ApplyMerge(db, plan, resolve, dryRun)
+	if !dryRun {
+		db.GetData().Rotation = MergeRotationRules(db.GetData().Rotation, other.GetData().Rotation)
+		db.Save()
+	}
+	summary.Print()
+}
+
+// MergeResolver resolves conflicts with the strategy, or by asking when
+// there is none; with conflicts, no strategy and no terminal it fails
+func MergeResolver(plan MergePlan, strategy string) (func(MergeConflict) string, error) {
+	if strategy != "" || len(plan.Conflicts) == 0 {
+		return func(MergeConflict) string { return strategy }, nil
+	}
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return nil, mergeConflictsError(plan.Conflicts)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	return func(conflict MergeConflict) string { return askMergeStrategy(reader, conflict) }, nil
+}
+
+// mergeConflictsError lists the conflicts that need a -strategy
+func mergeConflictsError(conflicts []MergeConflict) error {
+	lines := []string{fmt.Sprintf("%v entries changed in both vaults, use -strategy %v:", len(conflicts), strings.Join(MERGE_STRATEGIES, "|"))}
+	for _, conflict := range conflicts {
+		lines = append(lines, fmt.Sprintf("    %v (%v)", conflict.Ours.Key, strings.Join(DiffFields(conflict.Ours, conflict.Theirs), ", ")))
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+func askMergeStrategy(reader *bufio.Reader, conflict MergeConflict) string {
+	fmt.Printf("\n'%v' changed in both vaults (%v)\n", conflict.Ours.Key, strings.Join(DiffFields(conflict.Ours, conflict.Theirs), ", "))
+	fmt.Printf("    ours   updated %v\n", conflict.Ours.LastUpdated.Format(time.RFC3339))
+	fmt.Printf("    theirs updated %v\n", conflict.Theirs.LastUpdated.Format(time.RFC3339))
+	for {
+		fmt.Printf("Keep [o]urs, [t]heirs, [n]ewest or [b]oth? ")
+		line, err := reader.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		for _, strategy := range MERGE_STRATEGIES {
+			if answer != "" && strings.HasPrefix(strategy, answer) {
+				return strategy
+			}
+		}
+		if err != nil {
+			return MERGE_OURS
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanMerge(t *testing.T) {
+	synced := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := synced.Add(time.Hour)
+	ours := []DBEntry{
+		{Key: "same", Value: "1", LastUpdated: synced},
+		{Key: "ours-changed", Value: "new", LastUpdated: later},
+		{Key: "theirs-changed", Value: "old", LastUpdated: synced.Add(-time.Hour)},
+		{Key: "both-changed", Value: "ours", LastUpdated: later},
+	}
+	theirs := []DBEntry{
+		{Key: "same", Value: "1", LastUpdated: synced},
+		{Key: "ours-changed", Value: "old", LastUpdated: synced.Add(-time.Hour)},
+		{Key: "theirs-changed", Value: "new", LastUpdated: later},
+		{Key: "both-changed", Value: "theirs", LastUpdated: later.Add(time.Minute)},
+		{Key: "added", Value: "x", LastUpdated: later},
+	}
+
+	plan := PlanMerge(ours, theirs, nil, nil)
+	if plan.Unchanged != 2 {
+		t.Fatalf("expected 2 unchanged, got %v", plan.Unchanged)
+	}
+	if len(plan.Changes) != 2 || plan.Changes[0].Key != "theirs-changed" || plan.Changes[1].Key != "added" {
+		t.Fatalf("unexpected changes %+v", plan.Changes)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Ours.Key != "both-changed" {
+		t.Fatalf("unexpected conflicts %+v", plan.Conflicts)
+	}
+}
+
+func TestApplyMergeBoth(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "ours"})
+	plan := MergePlan{Conflicts: []MergeConflict{{Ours: DBEntry{Key: "a", Value: "ours"}, Theirs: DBEntry{Key: "a", Value: "theirs"}}}}
+
+	summary := ApplyMerge(db, plan, func(MergeConflict) string { return MERGE_BOTH }, false)
+	if summary.Count(IMPORT_RENAME) != 1 {
+		t.Fatalf("expected a rename, got %+v", summary.Actions)
+	}
+	if e, _ := db.GetDecrypted("a"); e.Value != "ours" {
+		t.Fatalf("expected ours to be kept, got %v", e.Value)
+	}
+	if e, _ := db.GetDecrypted("a-2"); e.Value != "theirs" {
+		t.Fatalf("expected theirs under a-2, got %v", e.Value)
+	}
+}
+
+func TestPlanMergeThroughPut(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "1"})
+	db.Put(DBEntry{Key: "b", Value: "2"})
+	snapshot := func() []DBEntry {
+		a, _ := db.GetDecrypted("a")
+		b, _ := db.GetDecrypted("b")
+		return []DBEntry{a, b}
+	}
+	ours := snapshot()
+
+	// an update on their side keeps the created time, so it is a change
+	// rather than a conflict
+	db.Put(DBEntry{Key: "a", Value: "changed"})
+	plan := PlanMerge(ours, snapshot(), nil, nil)
+	if len(plan.Changes) != 1 || plan.Changes[0].Value != "changed" || len(plan.Conflicts) != 0 || plan.Unchanged != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+}
+
+func TestPlanMergeDeletions(t *testing.T) {
+	synced := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := synced.Add(time.Hour)
+	ours := []DBEntry{
+		{Key: "they-deleted", Value: "1", LastUpdated: synced},
+		{Key: "we-updated", Value: "2", LastUpdated: later.Add(time.Minute)},
+	}
+	theirs := []DBEntry{
+		{Key: "we-deleted", Value: "3", LastUpdated: synced},
+		{Key: "they-updated", Value: "4", LastUpdated: later.Add(time.Minute)},
+	}
+	ourDeleted := map[string]time.Time{"we-deleted": later, "they-updated": later}
+	theirDeleted := map[string]time.Time{"they-deleted": later, "we-updated": later}
+
+	plan := PlanMerge(ours, theirs, ourDeleted, theirDeleted)
+	if len(plan.Deletions) != 1 || plan.Deletions[0] != "they-deleted" {
+		t.Fatalf("expected their deletion only, got %+v", plan.Deletions)
+	}
+	// an entry updated after the other side deleted it comes back
+	if len(plan.Changes) != 1 || plan.Changes[0].Key != "they-updated" {
+		t.Fatalf("expected only the entry updated after our deletion, got %+v", plan.Changes)
+	}
+
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "they-deleted", Value: "1"})
+	db.Put(DBEntry{Key: "we-updated", Value: "2"})
+	summary := ApplyMerge(db, plan, func(MergeConflict) string { return MERGE_OURS }, false)
+	if summary.Count(IMPORT_DELETE) != 1 {
+		t.Fatalf("expected a deletion, got %+v", summary.Actions)
+	}
+	if _, exists := db.GetData().Entries["they-deleted"]; exists {
+		t.Fatalf("expected their deletion to be applied")
+	}
+	deleted := db.GetData().Deleted
+	if !deleted["they-deleted"].Equal(later) {
+		t.Fatalf("expected their deletion to be kept, got %v", deleted)
+	}
+	if _, exists := deleted["we-updated"]; exists {
+		t.Fatalf("expected no deletion for an entry we still have, got %v", deleted)
+	}
+}
+
+func TestMergeResolverWithoutTerminal(t *testing.T) {
+	plan := MergePlan{Conflicts: []MergeConflict{{Ours: DBEntry{Key: "a", Value: "ours"}, Theirs: DBEntry{Key: "a", Value: "theirs"}}}}
+	if _, err := MergeResolver(plan, ""); err == nil || !strings.Contains(err.Error(), "a (value)") {
+		t.Fatalf("expected the conflicts as an error, got %v", err)
+	}
+	resolve, err := MergeResolver(plan, MERGE_THEIRS)
+	if err != nil || resolve(plan.Conflicts[0]) != MERGE_THEIRS {
+		t.Fatalf("expected the strategy, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cli "github.com/simonski/cli"
+)
+
+// NAMESPACE_SEPARATOR splits a key into namespaces, e.g. work/aws/prod/root
+const NAMESPACE_SEPARATOR = "/"
+
+// IsNamespace is true for a key prefix such as "work/aws/" (rather than a key)
+func IsNamespace(key string) bool {
+	return strings.HasSuffix(key, NAMESPACE_SEPARATOR) && !strings.HasPrefix(key, NAMESPACE_SEPARATOR) &&
+		!strings.ContainsAny(key, " \t")
+}
+
+// KeysUnder lists the keys in a namespace, sorted
+func KeysUnder(db *KPDB, namespace string) []string {
+	keys := make([]string, 0)
+	for key := range db.GetData().Entries {
+		if strings.HasPrefix(key, namespace) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ResolveKeys is the key itself, or every key under it when it is a
+// namespace; it fails when there are none
+func ResolveKeys(db *KPDB, key string) ([]string, error) {
+	if IsNamespace(key) {
+		keys := KeysUnder(db, key)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("there are no keys under '%v'", key)
+		}
+		return keys, nil
+	}
+	if _, exists := db.GetData().Entries[key]; !exists {
+		return nil, fmt.Errorf("'%v' does not exist", key)
+	}
+	return []string{key}, nil
+}
+
+// UpdateEntries changes the metadata of the key, or of every key under a
+// namespace, returning how many were changed. Values are left encrypted as
+// they are; the db is not saved.
+func UpdateEntries(db *KPDB, key string, update func(entry *DBEntry)) (int, error) {
+	keys, err := ResolveKeys(db, key)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	for _, k := range keys {
+		entry := db.GetData().Entries[k]
+		update(&entry)
+		entry.LastUpdated = now
+		db.GetData().Entries[k] = entry
+	}
+	return len(keys), nil
+}
+
+// MoveKeys renames a key, or every key under a namespace to the same place
+// under another. Nothing moves if any new key is already taken; the db is
+// not saved.
+func MoveKeys(db *KPDB, from string, to string) (int, error) {
+	if IsNamespace(from) != IsNamespace(to) {
+		return 0, fmt.Errorf("a namespace (ending in '%v') can only be moved to another namespace", NAMESPACE_SEPARATOR)
+	}
+	keys, err := ResolveKeys(db, from)
+	if err != nil {
+		return 0, err
+	}
+	renames := make(map[string]string)
+	for _, key := range keys {
+		renames[key] = to + strings.TrimPrefix(key, from)
+	}
+	for old, renamed := range renames {
+		if _, moving := renames[renamed]; moving {
+			continue
+		}
+		if _, exists := db.GetData().Entries[renamed]; exists {
+			return 0, fmt.Errorf("cannot move '%v', '%v' already exists", old, renamed)
+		}
+	}
+
+	entries := db.GetData().Entries
+	moved := make(map[string]DBEntry)
+	for old, renamed := range renames {
+		entry := entries[old]
+		entry.Key = renamed
+		entry.LastUpdated = time.Now()
+		moved[renamed] = entry
+		db.Delete(old)
+	}
+	for key, entry := range moved {
+		entries[key] = entry
+		delete(db.GetData().Deleted, key)
+	}
+	return len(renames), nil
+}
+
+// KeyNode is a namespace or key in the tree of keys; a name can be both
+type KeyNode struct {
+	Name      string
+	Path      string // the full key, or namespace ending in "/"
+	IsKey     bool
+	Children  []*KeyNode
+	namespace map[string]*KeyNode
+}
+
+// BuildKeyTree arranges keys by namespace, with the children of each
+// namespace in name order
+func BuildKeyTree(keys []string) *KeyNode {
+	root := &KeyNode{namespace: make(map[string]*KeyNode)}
+	for _, key := range keys {
+		node := root
+		parts := strings.Split(key, NAMESPACE_SEPARATOR)
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				leaf := &KeyNode{Name: part, Path: key, IsKey: true}
+				node.Children = append(node.Children, leaf)
+				break
+			}
+			child, exists := node.namespace[part]
+			if !exists {
+				path := strings.Join(parts[:i+1], NAMESPACE_SEPARATOR) + NAMESPACE_SEPARATOR
+				child = &KeyNode{Name: part, Path: path, namespace: make(map[string]*KeyNode)}
+				node.namespace[part] = child
+				node.Children = append(node.Children, child)
+			}
+			node = child
+		}
+	}
+	root.sort()
+	return root
+}
+
+func (n *KeyNode) sort() {
+	sort.SliceStable(n.Children, func(a int, b int) bool {
+		if n.Children[a].Name != n.Children[b].Name {
+			return strings.ToLower(n.Children[a].Name) < strings.ToLower(n.Children[b].Name)
+		}
+		return n.Children[a].IsKey
+	})
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
+
+// Count is how many namespaces and keys are below the node
+func (n *KeyNode) Count() (int, int) {
+	namespaces, keys := 0, 0
+	for _, child := range n.Children {
+		if child.IsKey {
+			keys++
+			continue
+		}
+		ns, k := child.Count()
+		namespaces, keys = namespaces+ns+1, keys+k
+	}
+	return namespaces, keys
+}
+
+// Render draws the nodes below n with box-drawing lines
+func (n *KeyNode) Render() string {
+	var sb strings.Builder
+	n.render(&sb, "")
+	return sb.String()
+}
+
+func (n *KeyNode) render(sb *strings.Builder, indent string) {
+	for i, child := range n.Children {
+		branch, next := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+		name := child.Name
+		if !child.IsKey {
+			name += NAMESPACE_SEPARATOR
+		}
+		sb.WriteString(indent + branch + name + "\n")
+		child.render(sb, indent+next)
+	}
+}
+
+// DoTree is "kp tree [prefix]"
+func DoTree(c *cli.CLI) {
+	db := LoadDB()
+	prefix := ""
+	if positionals := Positionals(c); len(positionals) > 0 {
+		prefix = positionals[0]
+		if !strings.HasSuffix(prefix, NAMESPACE_SEPARATOR) {
+			prefix += NAMESPACE_SEPARATOR
+		}
+	}
+	keys := make([]string, 0)
+	for _, key := range KeysUnder(db, prefix) {
+		if HasFlag(c, "-a") || !db.GetData().Entries[key].Hidden {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Println("No entries found.")
+		return
+	}
+	tree := BuildKeyTree(keys)
+	if prefix == "" {
+		fmt.Println(".")
+	} else {
+		fmt.Println(prefix)
+	}
+	fmt.Print(tree.Render())
+	namespaces, count := tree.Count()
+	fmt.Printf("\n%v namespaces, %v keys\n", namespaces, count)
+}
+
+// DoMove is "kp mv <key> <new key>" and "kp mv <namespace/> <namespace/>"
+func DoMove(c *cli.CLI) {
+	positionals := Positionals(c)
+	db := LoadDB()
+	moved, err := MoveKeys(db, positionals[0], positionals[1])
+	if err != nil {
+		fmt.Printf("Error, %v.\n", err)
+		os.Exit(1)
+	}
+	db.Save()
+	fmt.Printf("Moved %v keys.\n", moved)
+}
+
+// ParentNamespace is the namespace a key or namespace is in, or ""
+func ParentNamespace(path string) string {
+	trimmed := strings.TrimSuffix(path, NAMESPACE_SEPARATOR)
+	index := strings.LastIndex(trimmed, NAMESPACE_SEPARATOR)
+	if index < 0 {
+		return ""
+	}
+	return trimmed[:index+1]
+}
+
+// TreeList is the TUI's list of entries, folded by namespace
+type TreeList struct {
+	Root     *KeyNode
+	Expanded map[string]bool // the unfolded namespaces
+}
+
+// TreeRow is a line of the TUI list, a namespace or a key
+type TreeRow struct {
+	Label string
+	Node  *KeyNode
+}
+
+// NewTreeList arranges entries by namespace, all folded or all unfolded
+func NewTreeList(entries []DBEntry, expanded bool) *TreeList {
+	keys := make([]string, 0)
+	for _, entry := range entries {
+		keys = append(keys, entry.Key)
+	}
+	t := &TreeList{Root: BuildKeyTree(keys), Expanded: make(map[string]bool)}
+	if expanded {
+		for _, namespace := range namespacesOf(t.Root) {
+			t.Expanded[namespace] = true
+		}
+	}
+	return t
+}
+
+func namespacesOf(node *KeyNode) []string {
+	namespaces := make([]string, 0)
+	for _, child := range node.Children {
+		if !child.IsKey {
+			namespaces = append(namespaces, child.Path)
+			namespaces = append(namespaces, namespacesOf(child)...)
+		}
+	}
+	return namespaces
+}
+
+// Toggle folds or unfolds a namespace
+func (t *TreeList) Toggle(namespace string) {
+	if t.Expanded[namespace] {
+		delete(t.Expanded, namespace)
+	} else {
+		t.Expanded[namespace] = true
+	}
+}
+
+// Rows are the visible lines: namespaces marked ▸ (folded) or ▾, with the
+// contents of unfolded ones indented below them
+func (t *TreeList) Rows() []TreeRow {
+	return t.rows(t.Root, "")
+}
+
+func (t *TreeList) rows(node *KeyNode, indent string) []TreeRow {
+	rows := make([]TreeRow, 0)
+	for _, child := range node.Children {
+		if child.IsKey {
+			rows = append(rows, TreeRow{Label: indent + "  " + child.Name, Node: child})
+			continue
+		}
+		marker := "▸ "
+		if t.Expanded[child.Path] {
+			marker = "▾ "
+		}
+		rows = append(rows, TreeRow{Label: indent + marker + child.Name + NAMESPACE_SEPARATOR, Node: child})
+		if t.Expanded[child.Path] {
+			rows = append(rows, t.rows(child, indent+"  ")...)
+		}
+	}
+	return rows
+}
+
+// Labels are the text of the rows
+func (t *TreeList) Labels(rows []TreeRow) []string {
+	labels := make([]string, 0)
+	for _, row := range rows {
+		labels = append(labels, row.Label)
+	}
+	return labels
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMoveKeys(t *testing.T) {
+	db := newTestDB(t)
+	for _, key := range []string{"work/old/a", "work/old/b/c", "work/oldish", "work/new/z"} {
+		db.Put(DBEntry{Key: key, Value: key})
+	}
+	moved, err := MoveKeys(db, "work/old/", "work/new/")
+	if err != nil || moved != 2 {
+		t.Fatalf("expected 2 keys moved, got %v %v", moved, err)
+	}
+	if keys := strings.Join(KeysUnder(db, "work/"), ","); keys != "work/new/a,work/new/b/c,work/new/z,work/oldish" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	entry, _ := db.GetDecrypted("work/new/b/c")
+	if entry.Key != "work/new/b/c" || entry.Value != "work/old/b/c" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	// a move that would overwrite a key moves nothing
+	db.Put(DBEntry{Key: "home/a", Value: "x"})
+	if _, err := MoveKeys(db, "work/new/", "home/"); err == nil {
+		t.Fatalf("expected a conflicting move to fail")
+	}
+	if len(KeysUnder(db, "work/new/")) != 3 {
+		t.Fatalf("expected nothing to move")
+	}
+	if _, err := MoveKeys(db, "home/", "home"); err == nil {
+		t.Fatalf("expected moving a namespace to a key to fail")
+	}
+}
+
+func TestUpdateEntriesUnderNamespace(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "work/a", Value: "1"})
+	db.Put(DBEntry{Key: "work/b", Value: "2"})
+	db.Put(DBEntry{Key: "home/a", Value: "3"})
+	changed, err := UpdateEntries(db, "work/", func(e *DBEntry) { e.Hidden = true })
+	if err != nil || changed != 2 || !db.GetData().Entries["work/b"].Hidden || db.GetData().Entries["home/a"].Hidden {
+		t.Fatalf("unexpected update %v %v", changed, err)
+	}
+	if _, err := UpdateEntries(db, "play/", func(e *DBEntry) {}); err == nil {
+		t.Fatalf("expected an empty namespace to fail")
+	}
+}
+
+func TestKeyTree(t *testing.T) {
+	tree := BuildKeyTree([]string{"work/aws/root", "work/github", "home", "work/aws/dev"})
+	expected := `├── home
+└── work/
+    ├── aws/
+    │   ├── dev
+    │   └── root
+    └── github
+`
+	if rendered := tree.Render(); rendered != expected {
+		t.Fatalf("unexpected tree\n%v", rendered)
+	}
+	if namespaces, keys := tree.Count(); namespaces != 2 || keys != 4 {
+		t.Fatalf("unexpected count %v %v", namespaces, keys)
+	}
+}
+
+func TestTreeList(t *testing.T) {
+	entries := []DBEntry{{Key: "work/aws/root"}, {Key: "work/github"}, {Key: "home"}}
+	list := NewTreeList(entries, false)
+	if labels := strings.Join(list.Labels(list.Rows()), "|"); labels != "  home|▸ work/" {
+		t.Fatalf("unexpected folded rows %v", labels)
+	}
+	list.Toggle("work/")
+	if labels := strings.Join(list.Labels(list.Rows()), "|"); labels != "  home|▾ work/|  ▸ aws/|    github" {
+		t.Fatalf("unexpected unfolded rows %v", labels)
+	}
+	if parent := ParentNamespace("work/aws/root"); parent != "work/aws/" {
+		t.Fatalf("unexpected parent %v", parent)
+	}
+}
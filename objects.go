@@ -1,10 +1,12 @@
 package main
 
 import (
+	"crypto/sha512"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -26,6 +28,13 @@ type DB struct {
 	Version string             `json:"version"`
 	Entries map[string]DBEntry `json:"entries"`
 	History map[string]DBEntry `json:"history"`
+
+	// Rotation holds the intervals for types and tags; see rotation.go
+	Rotation *RotationRules `json:"rotation,omitempty"`
+
+	// Deleted records when keys were removed, so a merge does not bring
+	// them back
+	Deleted map[string]time.Time `json:"deleted,omitempty"`
 }
 
 func NewDB() *DB {
@@ -49,6 +58,19 @@ type DBEntry struct {
 	LastUpdated time.Time       `json:"lastUpdated"`
 	Created     time.Time       `json:"created"`
 	Hidden      bool            `json:"hidden"`
+	RotateDays  int             `json:"rotateDays,omitempty"` // change it every so many days, 0 for no interval
+}
+
+// TagList returns the entry's tags in sorted order
+func (e DBEntry) TagList() []string {
+	tags := make([]string, 0)
+	for tag, on := range e.Tags {
+		if on {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
 }
 
 // NewKPDB constructor
@@ -138,17 +160,75 @@ func (cdb *KPDB) Clear() {
 	cdb.data.Entries = make(map[string]DBEntry)
 }
 
-// Save writes the DB to disk
+// Save writes the DB to disk. It is written next to the file and renamed
+// over it, so a failed save never leaves a partial vault behind.
 func (cdb *KPDB) Save() bool {
-	data := cdb.data
-	file, _ := json.MarshalIndent(data, "", " ")
-	err := os.WriteFile(cdb.Filename, file, 0644)
+	err := WriteFileAtomic(cdb.Filename, MarshalDB(cdb.data), 0644)
 	if err != nil {
 		fmt.Printf("%v", err)
+		return false
 	}
 	return true
 }
 
+// MarshalDB is the saved form of the DB. encoding/json writes map keys in
+// sorted order, so unchanged entries stay put and diffs of the file are clean.
+func MarshalDB(db *DB) []byte {
+	data, _ := json.MarshalIndent(db, "", " ")
+	return append(data, '\n')
+}
+
+// ParseDB reads the saved form of a DB
+func ParseDB(data []byte) (*DB, error) {
+	db := NewDB()
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	if db.Entries == nil {
+		db.Entries = make(map[string]DBEntry)
+	}
+	if db.History == nil {
+		db.History = make(map[string]DBEntry)
+	}
+	return db, nil
+}
+
+// WriteFileAtomic writes data to a temporary file in the same directory and
+// renames it over filename, keeping the permissions of an existing file
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeAndRename(filename, data, perm)
+}
+
+// writeAndRename writes data to a new temporary file (created 0600, so the
+// data is never readable by others) next to filename, sets its permissions
+// and renames it over filename. A symlink at filename is replaced, not
+// followed.
+func writeAndRename(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
 // GetData returns the data map of all key
 func (cdb *KPDB) GetData() *DB {
 	return cdb.data
@@ -182,26 +262,67 @@ func (cdb *KPDB) Put(entry_in DBEntry) {
 	entry, exists := cdb.data.Entries[entry_in.Key]
 	encValue, _ := cdb.Encrypt(entry_in.Value)
 	entry_in.Value = encValue
-	if !exists {
+	if exists {
 		entry_in.Created = entry.Created
 	} else {
 		entry_in.Created = time.Now()
 	}
 	entry_in.LastUpdated = time.Now()
 	cdb.data.Entries[entry_in.Key] = entry_in
+	delete(cdb.data.Deleted, entry_in.Key)
 }
 
-// Delete removes the key/value pair from the DB
+// Delete removes the key/value pair from the DB, remembering when
 func (cdb *KPDB) Delete(key string) {
 	delete(cdb.data.Entries, key)
+	if cdb.data.Deleted == nil {
+		cdb.data.Deleted = make(map[string]time.Time)
+	}
+	cdb.data.Deleted[key] = time.Now()
 }
 
-// Encrypt helper function encrypts with public key
+// CHUNK_SEPARATOR joins the encrypted chunks of a value too large to encrypt
+// in one go; it is not part of the base64 alphabet so values stored before
+// chunking still decrypt
+const CHUNK_SEPARATOR = ":"
+
+// Encrypt helper function encrypts with public key. RSA can only encrypt a
+// little less than the key size at once, so larger values (certificates,
+// multi-line files) are encrypted in chunks.
 func (cdb *KPDB) Encrypt(value string) (string, error) {
-	return crypto.EncryptWithPrivateKeyFilename(value, cdb.PrivateKeyFilename)
+	publicKey, err := crypto.LoadPublicFromPrivateKey(cdb.PrivateKeyFilename)
+	if err != nil {
+		return "", err
+	}
+	// OAEP with SHA-512 needs 2*64+2 bytes of padding
+	chunkSize := publicKey.Size() - 2*sha512.Size - 2
+	if len(value) <= chunkSize {
+		return crypto.EncryptWithPrivateKeyFilename(value, cdb.PrivateKeyFilename)
+	}
+	chunks := make([]string, 0)
+	for start := 0; start < len(value); start += chunkSize {
+		end := start + chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		encrypted, err := crypto.EncryptWithPrivateKeyFilename(value[start:end], cdb.PrivateKeyFilename)
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, encrypted)
+	}
+	return strings.Join(chunks, CHUNK_SEPARATOR), nil
 }
 
 // Decrypt helper function decrypts with private key
 func (cdb *KPDB) Decrypt(value string) (string, error) {
-	return crypto.DecryptWithPrivateKeyFilename(value, cdb.PrivateKeyFilename)
+	var sb strings.Builder
+	for _, chunk := range strings.Split(value, CHUNK_SEPARATOR) {
+		decrypted, err := crypto.DecryptWithPrivateKeyFilename(chunk, cdb.PrivateKeyFilename)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(decrypted)
+	}
+	return sb.String(), nil
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptLargeValue(t *testing.T) {
+	db := newTestDB(t)
+	value := strings.Repeat("-----BEGIN CERTIFICATE-----\nMIIB\x00\xff\n", 40)
+	encrypted, err := db.Encrypt(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(encrypted, CHUNK_SEPARATOR) {
+		t.Fatalf("expected a chunked value")
+	}
+	decrypted, err := db.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != value {
+		t.Fatalf("round trip changed the value")
+	}
+}
+
+func TestPutKeepsCreated(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "1"})
+	created := db.GetData().Entries["a"].Created
+	if created.IsZero() {
+		t.Fatalf("expected a new entry to get a created time")
+	}
+	db.Put(DBEntry{Key: "a", Value: "2"})
+	if entry := db.GetData().Entries["a"]; !entry.Created.Equal(created) || entry.LastUpdated.Before(created) {
+		t.Fatalf("expected an update to keep the created time, got %+v", entry)
+	}
+}
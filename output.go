@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	cli "github.com/simonski/cli"
+)
+
+// error codes returned in the "code" field of a JSON error; these are part of
+// the output contract so scripts can rely on them
+const (
+	ERR_NOT_FOUND      = "not_found"
+	ERR_USAGE          = "usage"
+	ERR_UNKNOWN        = "unknown_command"
+	ERR_NOT_CONFIGURED = "not_configured"
+)
+
+// EntryJSON is the machine-readable form of a DBEntry
+type EntryJSON struct {
+	Key         string    `json:"key" yaml:"key"`
+	Value       *string   `json:"value,omitempty" yaml:"value,omitempty"`
+	Description string    `json:"description" yaml:"description"`
+	Notes       string    `json:"notes" yaml:"notes"`
+	Username    string    `json:"username" yaml:"username"`
+	Url         string    `json:"url" yaml:"url"`
+	Type        string    `json:"type" yaml:"type"`
+	Tags        []string  `json:"tags" yaml:"tags"`
+	Hidden      bool      `json:"hidden" yaml:"hidden"`
+	RotateDays  int       `json:"rotateDays,omitempty" yaml:"rotateDays,omitempty"`
+	Created     time.Time `json:"created" yaml:"created"`
+	LastUpdated time.Time `json:"lastUpdated" yaml:"lastUpdated"`
+}
+
+// ErrorJSON is the machine-readable form of an error
+type ErrorJSON struct {
+	Error   bool   `json:"error"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewEntryJSON converts an entry, only including the value when asked to
+func NewEntryJSON(entry DBEntry, includeValue bool) EntryJSON {
+	e := EntryJSON{
+		Key:         entry.Key,
+		Description: entry.Description,
+		Notes:       entry.Notes,
+		Username:    entry.Username,
+		Url:         entry.Url,
+		Type:        entry.Type,
+		Tags:        entry.TagList(),
+		Hidden:      entry.Hidden,
+		RotateDays:  entry.RotateDays,
+		Created:     entry.Created,
+		LastUpdated: entry.LastUpdated,
+	}
+	if includeValue {
+		value := entry.Value
+		e.Value = &value
+	}
+	return e
+}
+
+// IsJSON indicates -json or -jsonl was passed
+func IsJSON(c *cli.CLI) bool {
+	return HasFlag(c, "-json") || HasFlag(c, "-jsonl")
+}
+
+// IsJSONL indicates -jsonl was passed (one object per line)
+func IsJSONL(c *cli.CLI) bool {
+	return HasFlag(c, "-jsonl")
+}
+
+// PrintJSON writes a single object, indented for -json and compact for -jsonl
+func PrintJSON(c *cli.CLI, v interface{}) {
+	var data []byte
+	if IsJSONL(c) {
+		data, _ = json.Marshal(v)
+	} else {
+		data, _ = json.MarshalIndent(v, "", "  ")
+	}
+	fmt.Println(string(data))
+}
+
+// PrintJSONList writes a list as a JSON array for -json, or as one object per
+// line for -jsonl
+func PrintJSONList[T any](c *cli.CLI, items []T) {
+	if IsJSONL(c) {
+		for _, item := range items {
+			PrintJSON(c, item)
+		}
+	} else {
+		PrintJSON(c, items)
+	}
+}
+
+// Fail reports an error (as JSON when requested) and exits
+func Fail(c *cli.CLI, code string, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if IsJSON(c) {
+		PrintJSON(c, ErrorJSON{Error: true, Code: code, Message: message})
+	} else {
+		fmt.Println(message)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	cli "github.com/simonski/cli"
+	terminal "golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+var PLAINTEXT_FORMATS = []string{"csv", "json", "yaml"}
+
+// PLAINTEXT_CSV_HEADER are the columns of a csv export
+var PLAINTEXT_CSV_HEADER = []string{"key", "value", "description", "notes", "username", "url", "type", "tags", "hidden", "created", "lastUpdated"}
+
+// FormatPlaintext renders decrypted entries as csv, json or yaml
+func FormatPlaintext(entries []DBEntry, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(plaintextEntries(entries), "", "  ")
+		return append(data, '\n'), err
+	case "yaml":
+		return yaml.Marshal(plaintextEntries(entries))
+	case "csv":
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write(PLAINTEXT_CSV_HEADER)
+		for _, e := range entries {
+			writer.Write([]string{e.Key, e.Value, e.Description, e.Notes, e.Username, e.Url, e.Type,
+				strings.Join(e.TagList(), ";"), fmt.Sprint(e.Hidden), e.Created.Format(time.RFC3339), e.LastUpdated.Format(time.RFC3339)})
+		}
+		writer.Flush()
+		return buffer.Bytes(), writer.Error()
+	}
+	return nil, fmt.Errorf("cannot export '%v', the formats are: %v", format, strings.Join(PLAINTEXT_FORMATS, ", "))
+}
+
+func plaintextEntries(entries []DBEntry) []EntryJSON {
+	result := make([]EntryJSON, 0)
+	for _, e := range entries {
+		result = append(result, NewEntryJSON(e, true))
+	}
+	return result
+}
+
+// DoExportPlaintext is "kp export -plaintext -format csv|json|yaml"; it has
+// to be confirmed (or -i-understand passed), will not print to a terminal
+// without -stdout, writes files 0600 and logs the export
+func DoExportPlaintext(c *cli.CLI, filename string) {
+	format := FlagString(c, "-format", "json")
+	if !contains(PLAINTEXT_FORMATS, format) {
+		fmt.Printf("Error, -format must be one of %v.\n", strings.Join(PLAINTEXT_FORMATS, ", "))
+		os.Exit(1)
+	}
+	if filename == "" && terminal.IsTerminal(int(syscall.Stdout)) && !HasFlag(c, "-stdout") {
+		fmt.Printf("Error, refusing to print every secret to the terminal, use -o <file> (or -stdout).\n")
+		os.Exit(1)
+	}
+
+	db := LoadDB()
+	entries := DecryptAll(db)
+	if !HasFlag(c, "-i-understand") && !confirmPlaintext(len(entries), filename) {
+		fmt.Fprintf(os.Stderr, "Export cancelled.\n")
+		os.Exit(1)
+	}
+
+	data, err := FormatPlaintext(entries, format)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	destination := "stdout"
+	if filename != "" {
+		destination, _ = filepath.Abs(filename)
+	}
+	if err := LogEvent("export plaintext format=%v entries=%v to=%v", format, len(entries), destination); err != nil {
+		fmt.Printf("Error, cannot log the export, nothing was written: %v\n", err)
+		os.Exit(1)
+	}
+
+	if filename == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := WritePrivateFile(filename, data); err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %v entries in plaintext to %v.\n", len(entries), filename)
+}
+
+// confirmPlaintext asks on the terminal; without one the export needs
+// -i-understand
+func confirmPlaintext(count int, filename string) bool {
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		fmt.Fprintf(os.Stderr, "Error, a plaintext export needs -i-understand when it cannot be confirmed on a terminal.\n")
+		return false
+	}
+	if filename == "" {
+		filename = "stdout"
+	}
+	fmt.Fprintf(os.Stderr, "This writes %v secrets, unencrypted, to %v. Type 'yes' to continue: ", count, filename)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line) == "yes"
+}
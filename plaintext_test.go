@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatPlaintext(t *testing.T) {
+	entries := []DBEntry{{Key: "a", Value: "secret, with a comma", Tags: tagSet([]string{"x", "y"})}}
+
+	csv, err := FormatPlaintext(entries, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(csv), "\n")
+	if lines[0] != strings.Join(PLAINTEXT_CSV_HEADER, ",") || !strings.HasPrefix(lines[1], `a,"secret, with a comma",`) || !strings.Contains(lines[1], ",x;y,") {
+		t.Fatalf("unexpected csv %q", csv)
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		data, err := FormatPlaintext(entries, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "secret, with a comma") {
+			t.Fatalf("expected the value in the %v export, got %s", format, data)
+		}
+	}
+
+	if _, err := FormatPlaintext(entries, "xml"); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kp.log")
+	t.Setenv(KP_LOG, filename)
+	if err := LogEvent("export plaintext entries=%v", 3); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected 0600, got %v", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(filename)
+	if !strings.HasSuffix(string(data), " export plaintext entries=3\n") {
+		t.Fatalf("unexpected log %q", data)
+	}
+}
+
+func TestExportTarget(t *testing.T) {
+	cases := []struct {
+		positionals []string
+		output      string
+		format      string
+		filename    string
+	}{
+		{[]string{"dump.json"}, "", BUNDLE_FORMAT, "dump.json"},
+		{nil, "dump.json", BUNDLE_FORMAT, "dump.json"},
+		{[]string{"kdbx", "vault.kdbx"}, "", "kdbx", "vault.kdbx"},
+		{[]string{"kdbx"}, "vault.kdbx", "kdbx", "vault.kdbx"},
+	}
+	for _, c := range cases {
+		format, filename := exportTarget(c.positionals, c.output)
+		if format != c.format || filename != c.filename {
+			t.Fatalf("%v -o %v: expected %v %v, got %v %v", c.positionals, c.output, c.format, c.filename, format, filename)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	cli "github.com/simonski/cli"
+)
+
+// the character classes passwords are made from
+const (
+	UPPER_CHARS     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	LOWER_CHARS     = "abcdefghijklmnopqrstuvwxyz"
+	DIGIT_CHARS     = "0123456789"
+	SYMBOL_CHARS    = "!@#$%^&*()-_=+[]{}|;:,.<>?/"
+	AMBIGUOUS_CHARS = "O0oIl1|"
+)
+
+// DEFAULT_POLICY is used when no policy is named
+const DEFAULT_POLICY = "default"
+
+// PasswordPolicy is how a password is generated: its length, the classes of
+// character it is made of and how many of each it must have at least
+type PasswordPolicy struct {
+	Length      int    `json:"length"`
+	Upper       bool   `json:"upper"`
+	Lower       bool   `json:"lower"`
+	Digits      bool   `json:"digits"`
+	Symbols     string `json:"symbols"` // the symbols allowed, "" for none
+	NoAmbiguous bool   `json:"noAmbiguous"`
+	MinUpper    int    `json:"minUpper"`
+	MinLower    int    `json:"minLower"`
+	MinDigits   int    `json:"minDigits"`
+	MinSymbols  int    `json:"minSymbols"`
+}
+
+// POLICIES are the built in policies; the config file can add to them or
+// replace them
+var POLICIES = map[string]PasswordPolicy{
+	DEFAULT_POLICY: {Length: 64, Upper: true, Lower: true, Digits: true, Symbols: SYMBOL_CHARS},
+	"alnum":        {Length: 32, Upper: true, Lower: true, Digits: true, MinUpper: 1, MinLower: 1, MinDigits: 1},
+	"pin":          {Length: 6, Digits: true},
+	"strict": {Length: 24, Upper: true, Lower: true, Digits: true, Symbols: SYMBOL_CHARS, NoAmbiguous: true,
+		MinUpper: 2, MinLower: 2, MinDigits: 2, MinSymbols: 2},
+}
+
+// Policies are the built in policies with those from the config file
+func Policies(config *Config) map[string]PasswordPolicy {
+	policies := make(map[string]PasswordPolicy)
+	for name, policy := range POLICIES {
+		policies[name] = policy
+	}
+	for name, policy := range config.Policies {
+		policies[name] = policy
+	}
+	return policies
+}
+
+// classes are the characters the policy draws from: upper, lower, digits
+// and symbols, in the order of minimums; a class that is off is empty
+func (p PasswordPolicy) classes() [][]rune {
+	sets := []struct {
+		on    bool
+		chars string
+	}{{p.Upper, UPPER_CHARS}, {p.Lower, LOWER_CHARS}, {p.Digits, DIGIT_CHARS}, {p.Symbols != "", p.Symbols}}
+	classes := make([][]rune, 0)
+	for _, set := range sets {
+		chars := make([]rune, 0)
+		for _, r := range set.chars {
+			if set.on && !(p.NoAmbiguous && strings.ContainsRune(AMBIGUOUS_CHARS, r)) {
+				chars = append(chars, r)
+			}
+		}
+		classes = append(classes, chars)
+	}
+	return classes
+}
+
+func (p PasswordPolicy) minimums() []int {
+	return []int{p.MinUpper, p.MinLower, p.MinDigits, p.MinSymbols}
+}
+
+// Validate checks a password can be made with the policy
+func (p PasswordPolicy) Validate() error {
+	if p.Length <= 0 {
+		return fmt.Errorf("the length must be more than 0")
+	}
+	pool, required := 0, 0
+	for i, class := range p.classes() {
+		pool += len(class)
+		minimum := p.minimums()[i]
+		if minimum > 0 && len(class) == 0 {
+			return fmt.Errorf("there is a minimum for a class of characters that is turned off")
+		}
+		required += minimum
+	}
+	if pool == 0 {
+		return fmt.Errorf("there are no characters to choose from")
+	}
+	if required > p.Length {
+		return fmt.Errorf("the minimums add up to %v, more than the length of %v", required, p.Length)
+	}
+	return nil
+}
+
+// Generate makes a password: the minimum from each class, the rest from
+// all of them, shuffled
+func (p PasswordPolicy) Generate() (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	password := make([]rune, 0, p.Length)
+	pool := make([]rune, 0)
+	for i, class := range p.classes() {
+		pool = append(pool, class...)
+		for n := 0; n < p.minimums()[i]; n++ {
+			r, err := randomRune(class)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, r)
+		}
+	}
+	for len(password) < p.Length {
+		r, err := randomRune(pool)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, r)
+	}
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+func randomRune(chars []rune) (rune, error) {
+	index, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[index], nil
+}
+
+// randomInt is a uniformly random number in [0, max)
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+// PolicyFromFlags is the named -policy (or the default) with any of the
+// generator flags applied over it
+func PolicyFromFlags(c *cli.CLI) (PasswordPolicy, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return PasswordPolicy{}, err
+	}
+	name := FlagString(c, "-policy", DEFAULT_POLICY)
+	policy, exists := Policies(config)[name]
+	if !exists {
+		return policy, fmt.Errorf("there is no policy '%v'", name)
+	}
+	if HasFlag(c, "-length") {
+		policy.Length = FlagInt(c, "-length", policy.Length)
+	}
+	policy.Upper = policy.Upper && !HasFlag(c, "-no-upper")
+	policy.Lower = policy.Lower && !HasFlag(c, "-no-lower")
+	policy.Digits = policy.Digits && !HasFlag(c, "-no-digits")
+	if HasFlag(c, "-symbols") {
+		policy.Symbols = FlagString(c, "-symbols", policy.Symbols)
+	}
+	if HasFlag(c, "-no-symbols") {
+		policy.Symbols = ""
+	}
+	policy.NoAmbiguous = policy.NoAmbiguous || HasFlag(c, "-no-ambiguous")
+	if HasFlag(c, "-min") {
+		minimum := FlagInt(c, "-min", 0)
+		minimums := []*int{&policy.MinUpper, &policy.MinLower, &policy.MinDigits, &policy.MinSymbols}
+		for i, class := range policy.classes() {
+			*minimums[i] = 0
+			if len(class) > 0 {
+				*minimums[i] = minimum
+			}
+		}
+	}
+	return policy, nil
+}
+
+// DoPolicies is "kp policies", listing the built in and configured policies
+func DoPolicies(c *cli.CLI) {
+	config, err := LoadConfig()
+	if err != nil {
+		Fail(c, ERR_NOT_CONFIGURED, "Error, %v", err)
+	}
+	policies := Policies(config)
+	if IsJSON(c) {
+		PrintJSON(c, policies)
+		return
+	}
+	names := make([]string, 0)
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-10v %v\n", name, policies[name].Describe())
+	}
+}
+
+// Describe is a one line summary such as "24 characters, upper (2+), ..."
+func (p PasswordPolicy) Describe() string {
+	parts := []string{fmt.Sprintf("%v characters", p.Length)}
+	names := []string{"upper", "lower", "digits", "symbols"}
+	for i, class := range p.classes() {
+		if len(class) == 0 {
+			continue
+		}
+		part := names[i]
+		if i == 3 {
+			part = fmt.Sprintf("symbols %v", p.Symbols)
+		}
+		if minimum := p.minimums()[i]; minimum > 0 {
+			part += fmt.Sprintf(" (%v+)", minimum)
+		}
+		parts = append(parts, part)
+	}
+	if p.NoAmbiguous {
+		parts = append(parts, "no ambiguous characters")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GeneratePassword makes a password with the policy and flags given, or
+// exits with the error
+func GeneratePassword(c *cli.CLI, length int) string {
+	policy, err := PolicyFromFlags(c)
+	if err == nil && length > 0 {
+		policy.Length = length
+	}
+	password := ""
+	if err == nil {
+		password, err = policy.Generate()
+	}
+	if err != nil {
+		fmt.Printf("Error, %v.\n", err)
+		os.Exit(1)
+	}
+	return password
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyGenerate(t *testing.T) {
+	for name, policy := range POLICIES {
+		for i := 0; i < 20; i++ {
+			password, err := policy.Generate()
+			if err != nil {
+				t.Fatalf("%v: %v", name, err)
+			}
+			if len(password) != policy.Length {
+				t.Fatalf("%v: expected %v characters, got %q", name, policy.Length, password)
+			}
+		}
+	}
+
+	strict := POLICIES["strict"]
+	for i := 0; i < 50; i++ {
+		password, _ := strict.Generate()
+		if strings.ContainsAny(password, AMBIGUOUS_CHARS) {
+			t.Fatalf("ambiguous characters in %q", password)
+		}
+		counts := []int{0, 0, 0, 0}
+		for _, r := range password {
+			for class, chars := range []string{UPPER_CHARS, LOWER_CHARS, DIGIT_CHARS, SYMBOL_CHARS} {
+				if strings.ContainsRune(chars, r) {
+					counts[class]++
+				}
+			}
+		}
+		for class, count := range counts {
+			if count < 2 {
+				t.Fatalf("expected at least 2 of class %v in %q", class, password)
+			}
+		}
+	}
+
+	pin, _ := POLICIES["pin"].Generate()
+	if strings.Trim(pin, DIGIT_CHARS) != "" {
+		t.Fatalf("expected only digits, got %q", pin)
+	}
+	custom := PasswordPolicy{Length: 30, Lower: true, Symbols: "_-"}
+	if password, _ := custom.Generate(); strings.Trim(password, LOWER_CHARS+"_-") != "" {
+		t.Fatalf("unexpected characters in %q", password)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	invalid := []PasswordPolicy{
+		{Length: 0, Digits: true},
+		{Length: 8},
+		{Length: 4, Digits: true, MinDigits: 5},
+		{Length: 8, Digits: true, MinUpper: 1},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", policy)
+		}
+	}
+}
+
+func TestConfigPolicies(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "kpconfig")
+	os.WriteFile(filename, []byte(`{"policies": {"bank": {"length": 8, "digits": true}, "pin": {"length": 4, "digits": true}}}`), 0600)
+	t.Setenv(KP_CONFIG, filename)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := Policies(config)
+	if policies["bank"].Length != 8 || policies["pin"].Length != 4 || policies["strict"].Length != 24 {
+		t.Fatalf("unexpected policies %+v", policies)
+	}
+
+	t.Setenv(KP_CONFIG, filepath.Join(t.TempDir(), "missing"))
+	if config, err := LoadConfig(); err != nil || len(config.Policies) != 0 {
+		t.Fatalf("a missing config should be empty, got %+v %v", config, err)
+	}
+}
+
+func TestRandomIntBeyondAByte(t *testing.T) {
+	highest := 0
+	for i := 0; i < 1000; i++ {
+		n, err := randomInt(7776)
+		if err != nil || n < 0 || n >= 7776 {
+			t.Fatalf("unexpected %v %v", n, err)
+		}
+		if n > highest {
+			highest = n
+		}
+	}
+	if highest < 256 {
+		t.Fatalf("expected choices beyond 256, the highest was %v", highest)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+
+	cli "github.com/simonski/cli"
+	terminal "golang.org/x/term"
+	"rsc.io/qr"
+)
+
+// QR_QUIET_ZONE is the light border around a code, in modules; ISO/IEC
+// 18004 requires at least 4 and some scanners fail with less
+const QR_QUIET_ZONE = 4
+
+// the escape sequences to switch to and from the terminal's alternate screen
+const (
+	ALT_SCREEN_ON  = "\x1b[?1049h\x1b[H"
+	ALT_SCREEN_OFF = "\x1b[?1049l"
+)
+
+// RenderQR draws text as a QR code, two rows of modules per line using
+// Unicode half blocks. Dark modules are blank so the code reads on a dark
+// terminal; invert for a light one.
+func RenderQR(text string, invert bool) (string, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	dark := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+			return invert
+		}
+		return code.Black(x, y) != invert
+	}
+	var sb strings.Builder
+	for y := -QR_QUIET_ZONE; y < code.Size+QR_QUIET_ZONE; y += 2 {
+		for x := -QR_QUIET_ZONE; x < code.Size+QR_QUIET_ZONE; x++ {
+			top, bottom := !dark(x, y), !dark(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// WifiURI is the Wi-Fi network QR payload phones understand; the SSID is the
+// username, or the key when there is none
+func WifiURI(entry DBEntry) string {
+	escape := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+	ssid := entry.Username
+	if ssid == "" {
+		ssid = entry.Key
+	}
+	return fmt.Sprintf("WIFI:T:WPA;S:%v;P:%v;;", escape.Replace(ssid), escape.Replace(entry.Value))
+}
+
+// OTPAuthURI is the otpauth:// URI authenticator apps import, with the value
+// as the (base32) TOTP secret. A value that already is a URI is used as is.
+func OTPAuthURI(entry DBEntry) string {
+	if strings.HasPrefix(entry.Value, "otpauth://") {
+		return entry.Value
+	}
+	issuer := entry.Key
+	if u, err := url.Parse(entry.Url); err == nil && u.Host != "" {
+		issuer = u.Host
+	}
+	label := issuer
+	if entry.Username != "" {
+		label = issuer + ":" + entry.Username
+	}
+	secret := strings.ToUpper(strings.ReplaceAll(entry.Value, " ", ""))
+	query := url.Values{"secret": {secret}, "issuer": {issuer}}
+	return fmt.Sprintf("otpauth://totp/%v?%v", url.PathEscape(label), query.Encode())
+}
+
+// DoQR is "kp qr <key>"
+func DoQR(c *cli.CLI) {
+	key := Positionals(c)[0]
+	db := LoadDB()
+	entry, exists := db.GetDecrypted(key)
+	if !exists {
+		fmt.Printf("'%v' does not exist.\n", key)
+		os.Exit(1)
+	}
+
+	text := entry.Value
+	var err error
+	switch {
+	case HasFlag(c, "-wifi"):
+		text = WifiURI(entry)
+	case HasFlag(c, "-otp"):
+		text = OTPAuthURI(entry)
+	case HasFlag(c, "-field"):
+		text, err = EntryField(entry, FlagString(c, "-field", "value"))
+	}
+	if err == nil && text == "" {
+		err = fmt.Errorf("there is nothing to encode in '%v'", key)
+	}
+	var code string
+	if err == nil {
+		code, err = RenderQR(text, HasFlag(c, "-invert"))
+	}
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+
+	if !HasFlag(c, "-clear") {
+		fmt.Print(code)
+		return
+	}
+	fd := int(syscall.Stdin)
+	if !terminal.IsTerminal(fd) {
+		fmt.Printf("Error, -clear needs a terminal to wait for a key on.\n")
+		os.Exit(1)
+	}
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(ALT_SCREEN_ON)
+	fmt.Print(strings.ReplaceAll(code, "\n", "\r\n"))
+	fmt.Printf("\r\n%v - press any key to clear\r\n", key)
+	os.Stdin.Read(make([]byte, 1))
+	fmt.Print(ALT_SCREEN_OFF)
+	terminal.Restore(fd, state)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWifiURI(t *testing.T) {
+	uri := WifiURI(DBEntry{Key: "home", Username: "My;Net", Value: `p:ss"w`})
+	if uri != `WIFI:T:WPA;S:My\;Net;P:p\:ss\"w;;` {
+		t.Fatalf("unexpected uri %v", uri)
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	uri := OTPAuthURI(DBEntry{Key: "gh", Url: "https://github.com/login", Username: "bob", Value: "jbsw y3dp"})
+	if uri != "otpauth://totp/github.com:bob?issuer=github.com&secret=JBSWY3DP" {
+		t.Fatalf("unexpected uri %v", uri)
+	}
+}
+
+func TestRenderQR(t *testing.T) {
+	code, err := RenderQR("hello", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+	width := len([]rune(lines[0]))
+	// a version 1 code is 21 modules, plus a quiet zone of 4 on both sides
+	if width != 21+2*4 || len(lines) != (width+1)/2 {
+		t.Fatalf("unexpected size %vx%v", width, len(lines))
+	}
+	if strings.Trim(lines[0], "█") != "" {
+		t.Fatalf("expected the quiet zone on the first line, got %q", lines[0])
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A query filters entries, e.g. 'tag:prod type:login url:*.aws.amazon.com
+// updated<90d -hidden'. Terms are ANDed unless joined with OR, and can be
+// negated with NOT, ! or - and grouped with parentheses.
+//
+//	field:text      the field contains text (case-insensitive); with * or ?
+//	                the whole field must match the glob (a url's host will do)
+//	field:/regex/   the field matches the regular expression
+//	tag:name        the entry has the tag (globs work here too)
+//	hidden          the entry is hidden
+//	created<30d     a date compared with <, <=, > or >=, either an age
+//	updated>=2024-01-01  (h, d, w, m, y) or a date (YYYY-MM-DD or RFC3339)
+//	word, /regex/   a word or regex matched against the key and metadata
+//
+// The fields are key, description, notes, username, url, type and tag.
+
+// QUERY_FIELDS maps the names (and short names) a query can use to the
+// entry fields they read
+var QUERY_FIELDS = map[string]string{
+	"key":         "key",
+	"description": "description",
+	"desc":        "description",
+	"notes":       "notes",
+	"note":        "notes",
+	"username":    "username",
+	"user":        "username",
+	"url":         "url",
+	"type":        "type",
+	"tag":         "tags",
+	"tags":        "tags",
+}
+
+// QUERY_DATES maps the date fields to the entry's timestamps
+var QUERY_DATES = map[string]func(DBEntry) time.Time{
+	"created":     func(e DBEntry) time.Time { return e.Created },
+	"updated":     func(e DBEntry) time.Time { return e.LastUpdated },
+	"lastupdated": func(e DBEntry) time.Time { return e.LastUpdated },
+}
+
+// Query is a parsed query
+type Query struct {
+	match func(DBEntry) bool
+
+	// Hidden is true when the query asks about hidden entries, so they
+	// should not be left out before it is applied
+	Hidden bool
+}
+
+// Match is true when the entry satisfies the query
+func (q *Query) Match(entry DBEntry) bool {
+	return q.match(entry)
+}
+
+var (
+	queryDateTerm   = regexp.MustCompile(`^([A-Za-z]+)(<=|>=|<|>)(.+)$`)
+	queryAge        = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+	queryFieldTerm  = regexp.MustCompile(`^([A-Za-z]+):(.*)$`)
+	queryOperators  = map[string]bool{"AND": true, "OR": true, "NOT": true, "&&": true, "||": true, "!": true, "(": true, ")": true}
+	queryAgeLengths = map[string]time.Duration{"h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "m": 30 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+)
+
+// IsQuery is true when the text uses any query syntax; plain words are a
+// fuzzy search instead
+func IsQuery(text string) bool {
+	for _, token := range tokenizeQuery(text) {
+		if queryOperators[token] || strings.HasPrefix(token, "-") || strings.HasPrefix(token, "!") || strings.ToLower(token) == "hidden" {
+			return true
+		}
+		if m := queryDateTerm.FindStringSubmatch(token); m != nil && QUERY_DATES[strings.ToLower(m[1])] != nil {
+			return true
+		}
+		if m := queryFieldTerm.FindStringSubmatch(token); m != nil && (QUERY_FIELDS[strings.ToLower(m[1])] != "" || strings.ToLower(m[1]) == "hidden") {
+			return true
+		}
+		if len(token) > 1 && strings.HasPrefix(token, "/") && strings.HasSuffix(token, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseQuery parses a query; ages are measured back from now
+func ParseQuery(text string, now time.Time) (*Query, error) {
+	p := &queryParser{tokens: tokenizeQuery(text), now: now, query: &Query{}}
+	if len(p.tokens) == 0 {
+		p.query.match = func(DBEntry) bool { return true }
+		return p.query, nil
+	}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%v' in the query", p.tokens[p.pos])
+	}
+	p.query.match = match
+	return p.query, nil
+}
+
+// tokenizeQuery splits on spaces, keeping quoted text and /regexes/ whole
+// and parentheses apart
+func tokenizeQuery(text string) []string {
+	tokens := make([]string, 0)
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	runes := []rune(text)
+	quote, regex := rune(0), false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case regex:
+			current.WriteRune(r)
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else if r == '/' {
+				regex = false
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '/' && (current.Len() == 0 || strings.HasSuffix(current.String(), ":")):
+			regex = true
+			current.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+	now    time.Time
+	query  *Query
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) parseOr() (func(DBEntry) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" || p.peek() == "or" || p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e DBEntry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (func(DBEntry) bool, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p.peek()
+		if next == "" || next == ")" || next == "OR" || next == "or" || next == "||" {
+			return left, nil
+		}
+		if next == "AND" || next == "and" || next == "&&" {
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e DBEntry) bool { return l(e) && right(e) }
+	}
+}
+
+func (p *queryParser) parseUnary() (func(DBEntry) bool, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("the query ends too soon")
+	case token == "NOT" || token == "not" || token == "!":
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e DBEntry) bool { return !inner(e) }, nil
+	case len(token) > 1 && (token[0] == '-' || token[0] == '!'):
+		p.tokens[p.pos] = token[1:]
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e DBEntry) bool { return !inner(e) }, nil
+	case token == "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("a ( is not closed in the query")
+		}
+		p.pos++
+		return inner, nil
+	case token == ")":
+		return nil, fmt.Errorf("unexpected ) in the query")
+	}
+	p.pos++
+	return p.parseTerm(token)
+}
+
+func (p *queryParser) parseTerm(token string) (func(DBEntry) bool, error) {
+	if strings.EqualFold(token, "hidden") {
+		p.query.Hidden = true
+		return func(e DBEntry) bool { return e.Hidden }, nil
+	}
+	if m := queryDateTerm.FindStringSubmatch(token); m != nil {
+		if date := QUERY_DATES[strings.ToLower(m[1])]; date != nil {
+			return p.parseDate(date, m[2], m[3])
+		}
+	}
+	if m := queryFieldTerm.FindStringSubmatch(token); m != nil {
+		name := strings.ToLower(m[1])
+		if name == "hidden" {
+			hidden, err := strconv.ParseBool(m[2])
+			if err != nil {
+				return nil, fmt.Errorf("hidden: expects true or false, got '%v'", m[2])
+			}
+			p.query.Hidden = true
+			return func(e DBEntry) bool { return e.Hidden == hidden }, nil
+		}
+		if field := QUERY_FIELDS[name]; field != "" {
+			matcher, err := queryMatcher(m[2], field == "tags")
+			if err != nil {
+				return nil, err
+			}
+			return fieldPredicate(field, matcher), nil
+		}
+	}
+
+	// a bare word (or /regex/) matches any of the searched fields
+	matcher, err := queryMatcher(token, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(e DBEntry) bool {
+		for _, field := range SEARCH_FIELDS {
+			if fieldPredicate(field.Name, matcher)(e) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// queryMatcher turns the text after "field:" into a string test: a /regex/,
+// a glob, an exact (tag) name or a substring
+func queryMatcher(text string, exact bool) (func(string) bool, error) {
+	if len(text) > 1 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		re, err := regexp.Compile(text[1 : len(text)-1])
+		if err != nil {
+			return nil, fmt.Errorf("bad regex %v: %v", text, err)
+		}
+		return re.MatchString, nil
+	}
+	lower := strings.ToLower(text)
+	if strings.ContainsAny(text, "*?[") {
+		if _, err := filepath.Match(lower, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern '%v'", text)
+		}
+		return func(s string) bool {
+			matched, _ := filepath.Match(lower, strings.ToLower(s))
+			return matched
+		}, nil
+	}
+	if exact {
+		return func(s string) bool { return strings.EqualFold(s, text) }, nil
+	}
+	return func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }, nil
+}
+
+// fieldPredicate tests one field of an entry: any of its tags, and a url's
+// host as well as the url itself
+func fieldPredicate(field string, matcher func(string) bool) func(DBEntry) bool {
+	return func(e DBEntry) bool {
+		switch field {
+		case "tags":
+			for _, tag := range e.TagList() {
+				if matcher(tag) {
+					return true
+				}
+			}
+			return false
+		case "url":
+			if matcher(e.Url) {
+				return true
+			}
+			u, err := url.Parse(e.Url)
+			return err == nil && u.Host != "" && matcher(u.Host)
+		}
+		value, _ := EntryField(e, field)
+		return matcher(value)
+	}
+}
+
+// parseDate compares a timestamp with an age ("90d", newer is smaller) or a
+// date ("2024-01-01", later is bigger)
+func (p *queryParser) parseDate(date func(DBEntry) time.Time, op string, value string) (func(DBEntry) bool, error) {
+	var compare func(e DBEntry) int
+	if m := queryAge.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		count, _ := strconv.Atoi(m[1])
+		cutoff := p.now.Add(-time.Duration(count) * queryAgeLengths[m[2]])
+		// an age compares the other way round to the time
+		compare = func(e DBEntry) int { return -compareTimes(date(e), cutoff) }
+	} else {
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return nil, err
+		}
+		compare = func(e DBEntry) int { return compareTimes(date(e), t) }
+	}
+	switch op {
+	case "<":
+		return func(e DBEntry) bool { return compare(e) < 0 }, nil
+	case "<=":
+		return func(e DBEntry) bool { return compare(e) <= 0 }, nil
+	case ">":
+		return func(e DBEntry) bool { return compare(e) > 0 }, nil
+	}
+	return func(e DBEntry) bool { return compare(e) >= 0 }, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%v' is not an age (e.g. 90d) or a date (e.g. 2024-01-01)", value)
+}
+
+func compareTimes(a time.Time, b time.Time) int {
+	if a.Before(b) {
+		return -1
+	} else if a.After(b) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	aws := DBEntry{Key: "aws/root", Type: "login", Url: "https://signin.aws.amazon.com/console", Tags: tagSet([]string{"prod"}),
+		Created: now.AddDate(-1, 0, 0), LastUpdated: now.AddDate(0, 0, -10)}
+	old := DBEntry{Key: "GitHub", Type: "login", Url: "https://github.com", Tags: tagSet([]string{"dev"}), Hidden: true,
+		Created: now.AddDate(-2, 0, 0), LastUpdated: now.AddDate(0, 0, -200)}
+	note := DBEntry{Key: "wifi", Type: "note", Notes: "router in the hall"}
+
+	cases := []struct {
+		query string
+		want  []bool // aws, old, note
+	}{
+		{"tag:prod type:login url:*.aws.amazon.com updated<90d -hidden", []bool{true, false, false}},
+		{"type:login", []bool{true, true, false}},
+		{"tag:prod OR tag:dev", []bool{true, true, false}},
+		{"NOT (tag:prod OR tag:dev)", []bool{false, false, true}},
+		{"hidden", []bool{false, true, false}},
+		{"hidden:false type:login", []bool{true, false, false}},
+		{"updated>90d", []bool{false, true, true}},
+		{"created<2023-01-01", []bool{false, true, true}},
+		{"key:/^git/", []bool{false, false, false}},
+		{"key:/(?i)^git/", []bool{false, true, false}},
+		{"router", []bool{false, false, true}},
+		{"/hall$/ !tag:prod", []bool{false, false, true}},
+		{"key:github && user:", []bool{false, true, false}},
+	}
+	for _, tc := range cases {
+		q, err := ParseQuery(tc.query, now)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.query, err)
+		}
+		for i, e := range []DBEntry{aws, old, note} {
+			if q.Match(e) != tc.want[i] {
+				t.Errorf("%v: expected %v for %v", tc.query, tc.want[i], e.Key)
+			}
+		}
+	}
+
+	for _, bad := range []string{"(tag:prod", "tag:prod OR", "key:/[/", "updated<soon"} {
+		if _, err := ParseQuery(bad, now); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestIsQuery(t *testing.T) {
+	for _, text := range []string{"tag:prod", "updated<90d", "a OR b", "-hidden", "/re/"} {
+		if !IsQuery(text) {
+			t.Errorf("expected %v to be a query", text)
+		}
+	}
+	for _, text := range []string{"github", "my key", "http://example.com"} {
+		if IsQuery(text) {
+			t.Errorf("expected %v to be a search", text)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if name := EnvName("aws/prod-key"); name != "AWS_PROD_KEY" {
+		t.Fatalf("unexpected name %v", name)
+	}
+	if name := EnvName("1password"); name != "_1PASSWORD" {
+		t.Fatalf("unexpected name %v", name)
+	}
+	if quoted := ShellQuote("it's"); quoted != `'it'\''s'` {
+		t.Fatalf("unexpected quoting %v", quoted)
+	}
+}
+
+func TestEnvExports(t *testing.T) {
+	lines, err := EnvExports([]DBEntry{{Key: "aws/key", Value: "it's"}, {Key: "db", Value: "x"}})
+	if err != nil || len(lines) != 2 || lines[0] != `export AWS_KEY='it'\''s'` || lines[1] != "export DB='x'" {
+		t.Fatalf("unexpected exports %v %v", lines, err)
+	}
+	if _, err := EnvExports([]DBEntry{{Key: "a/b"}, {Key: "a-b"}}); err == nil || !strings.Contains(err.Error(), "A_B") {
+		t.Fatalf("expected keys with the same name to fail, got %v", err)
+	}
+}
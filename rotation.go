@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cli "github.com/simonski/cli"
+)
+
+// DUE_SOON_DAYS is how far ahead kp due looks unless -days is given
+const DUE_SOON_DAYS = 14
+
+// the prefixes of a rotation target that is not a key
+const (
+	ROTATION_TYPE = "type:"
+	ROTATION_TAG  = "tag:"
+)
+
+// RotationRules are the rotation intervals (in days) for every entry of a
+// type or with a tag. They are saved in the DB, so they travel with it; an
+// interval for a single key is saved on its entry.
+type RotationRules struct {
+	Types map[string]int `json:"types,omitempty"`
+	Tags  map[string]int `json:"tags,omitempty"`
+}
+
+// clone copies the rules, nil staying nil
+func (r *RotationRules) clone() *RotationRules {
+	if r == nil {
+		return nil
+	}
+	clone := &RotationRules{Types: make(map[string]int), Tags: make(map[string]int)}
+	for name, days := range r.Types {
+		clone.Types[name] = days
+	}
+	for name, days := range r.Tags {
+		clone.Tags[name] = days
+	}
+	return clone
+}
+
+// MergeRotationRules is ours with any rules only theirs has
+func MergeRotationRules(ours *RotationRules, theirs *RotationRules) *RotationRules {
+	merged := ours.clone()
+	if theirs == nil {
+		return merged
+	}
+	if merged == nil {
+		merged = &RotationRules{Types: make(map[string]int), Tags: make(map[string]int)}
+	}
+	for name, days := range theirs.Types {
+		if _, exists := merged.Types[name]; !exists {
+			merged.Types[name] = days
+		}
+	}
+	for name, days := range theirs.Tags {
+		if _, exists := merged.Tags[name]; !exists {
+			merged.Tags[name] = days
+		}
+	}
+	return merged
+}
+
+// RotationInterval is how often the entry should be changed, in days, and
+// the rule it comes from ("key", "tag:prod" or "type:db-password"); 0 when
+// it has none. The entry's own interval wins, then the shortest of its
+// tags', then its type's.
+func (db *DB) RotationInterval(entry DBEntry) (int, string) {
+	if entry.RotateDays > 0 {
+		return entry.RotateDays, "key"
+	}
+	if db.Rotation == nil {
+		return 0, ""
+	}
+	days, rule := 0, ""
+	for _, tag := range entry.TagList() {
+		// rules are stored normalized, tags from before normalization may not be
+		if normalized, err := NormalizeTag(tag); err == nil {
+			tag = normalized
+		}
+		if d := db.Rotation.Tags[tag]; d > 0 && (days == 0 || d < days) {
+			days, rule = d, ROTATION_TAG+tag
+		}
+	}
+	if days > 0 {
+		return days, rule
+	}
+	name := strings.ToLower(entry.Type)
+	if d := db.Rotation.Types[name]; d > 0 {
+		return d, ROTATION_TYPE + name
+	}
+	return 0, ""
+}
+
+// RotationStatus is when an entry is next due to be changed
+type RotationStatus struct {
+	Key         string    `json:"key"`
+	Days        int       `json:"days"`
+	Rule        string    `json:"rule"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	Due         time.Time `json:"due"`
+	DaysLeft    int       `json:"daysLeft"` // negative when overdue
+	Overdue     bool      `json:"overdue"`
+}
+
+// RotationOf is the entry's status at now; false when it has no interval
+func (db *DB) RotationOf(entry DBEntry, now time.Time) (RotationStatus, bool) {
+	days, rule := db.RotationInterval(entry)
+	if days == 0 {
+		return RotationStatus{}, false
+	}
+	due := entry.LastUpdated.AddDate(0, 0, days)
+	return RotationStatus{
+		Key:         entry.Key,
+		Days:        days,
+		Rule:        rule,
+		LastUpdated: entry.LastUpdated,
+		Due:         due,
+		DaysLeft:    int(math.Floor(due.Sub(now).Hours() / 24)),
+		Overdue:     !now.Before(due),
+	}, true
+}
+
+// Describe is e.g. "overdue by 12 days" or "due in 3 days"
+func (s RotationStatus) Describe() string {
+	switch {
+	case s.Overdue:
+		return fmt.Sprintf("overdue by %v", pluralDays(-s.DaysLeft))
+	case s.DaysLeft == 0:
+		return "due today"
+	default:
+		return fmt.Sprintf("due in %v", pluralDays(s.DaysLeft))
+	}
+}
+
+func pluralDays(days int) string {
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%v days", days)
+}
+
+// DueEntries are the entries overdue or due within the given time of now,
+// the most overdue first
+func DueEntries(db *KPDB, now time.Time, within time.Duration, includeHidden bool) []RotationStatus {
+	due := make([]RotationStatus, 0)
+	for _, entry := range db.GetEntriesSortedByUpdatedThenKey() {
+		if entry.Hidden && !includeHidden {
+			continue
+		}
+		if status, ok := db.GetData().RotationOf(entry, now); ok && !status.Due.After(now.Add(within)) {
+			due = append(due, status)
+		}
+	}
+	sort.SliceStable(due, func(a int, b int) bool { return due[a].Due.Before(due[b].Due) })
+	return due
+}
+
+// SetRotation sets the interval of a key (or every key under a namespace),
+// a type ("type:db-password") or a tag ("tag:prod"); 0 days removes it.
+// It returns how many keys or rules it changed. The db is not saved.
+func SetRotation(db *KPDB, target string, days int) (int, error) {
+	if days < 0 {
+		return 0, fmt.Errorf("the interval must be a number of days")
+	}
+	data := db.GetData()
+	var rules *map[string]int
+	name := ""
+	switch {
+	case strings.HasPrefix(target, ROTATION_TYPE):
+		name = strings.ToLower(strings.TrimPrefix(target, ROTATION_TYPE))
+		if data.Rotation == nil {
+			data.Rotation = &RotationRules{}
+		}
+		rules = &data.Rotation.Types
+	case strings.HasPrefix(target, ROTATION_TAG):
+		tag, err := NormalizeTag(strings.TrimPrefix(target, ROTATION_TAG))
+		if err != nil {
+			return 0, err
+		}
+		name = tag
+		if data.Rotation == nil {
+			data.Rotation = &RotationRules{}
+		}
+		rules = &data.Rotation.Tags
+	default:
+		// unlike the other updates this leaves LastUpdated alone, as that
+		// is when the interval is counted from
+		keys, err := ResolveKeys(db, target)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range keys {
+			entry := data.Entries[key]
+			entry.RotateDays = days
+			data.Entries[key] = entry
+		}
+		return len(keys), nil
+	}
+
+	if name == "" {
+		return 0, fmt.Errorf("'%v' needs a name", target)
+	}
+	if days == 0 {
+		if _, exists := (*rules)[name]; !exists {
+			return 0, fmt.Errorf("there is no rotation for '%v'", target)
+		}
+		delete(*rules, name)
+	} else {
+		if *rules == nil {
+			*rules = make(map[string]int)
+		}
+		(*rules)[name] = days
+	}
+	if len(data.Rotation.Types) == 0 && len(data.Rotation.Tags) == 0 {
+		data.Rotation = nil
+	}
+	return 1, nil
+}
+
+// RotationRule is a target ("type:name", "tag:name" or a key) and its interval
+type RotationRule struct {
+	Target string `json:"target"`
+	Days   int    `json:"days"`
+}
+
+// RotationList is every rule: the types', the tags' and the keys with their
+// own interval, in that order
+func RotationList(db *KPDB) []RotationRule {
+	rules := make([]RotationRule, 0)
+	add := func(prefix string, names map[string]int) {
+		sorted := make([]string, 0)
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			rules = append(rules, RotationRule{prefix + name, names[name]})
+		}
+	}
+	if rotation := db.GetData().Rotation; rotation != nil {
+		add(ROTATION_TYPE, rotation.Types)
+		add(ROTATION_TAG, rotation.Tags)
+	}
+	keys := make(map[string]int)
+	for _, entry := range db.GetEntriesSortedByUpdatedThenKey() {
+		if entry.RotateDays > 0 {
+			keys[entry.Key] = entry.RotateDays
+		}
+	}
+	add("", keys)
+	return rules
+}
+
+// DoRotation is "kp rotation [set <target> <days> | rm <target>]"
+func DoRotation(c *cli.CLI) {
+	positionals := Positionals(c)
+	db := LoadDB()
+	if len(positionals) == 0 {
+		rules := RotationList(db)
+		if IsJSON(c) {
+			PrintJSONList(c, rules)
+			return
+		}
+		if len(rules) == 0 {
+			fmt.Println("No rotation rules.")
+			return
+		}
+		width := 0
+		for _, rule := range rules {
+			if len(rule.Target) > width {
+				width = len(rule.Target)
+			}
+		}
+		for _, rule := range rules {
+			fmt.Printf("%-*v  every %v\n", width, rule.Target, pluralDays(rule.Days))
+		}
+		return
+	}
+
+	action := positionals[0]
+	switch {
+	case action == "set" && len(positionals) == 3:
+		days, err := strconv.Atoi(strings.TrimSuffix(positionals[2], "d"))
+		if err == nil && days <= 0 {
+			err = fmt.Errorf("must be more than 0")
+		}
+		if err != nil {
+			fmt.Printf("Error, '%v' is not a number of days.\n", positionals[2])
+			os.Exit(1)
+		}
+		changed, err := SetRotation(db, positionals[1], days)
+		if err != nil {
+			fmt.Printf("Error, %v.\n", err)
+			os.Exit(1)
+		}
+		db.Save()
+		fmt.Printf("'%v' is rotated every %v (%v changed).\n", positionals[1], pluralDays(days), changed)
+	case action == "rm" && len(positionals) == 2:
+		if _, err := SetRotation(db, positionals[1], 0); err != nil {
+			fmt.Printf("Error, %v.\n", err)
+			os.Exit(1)
+		}
+		db.Save()
+		fmt.Printf("Removed the rotation for '%v'.\n", positionals[1])
+	default:
+		fmt.Printf("Usage: kp rotation [set <key|type:name|tag:name> <days> | rm <key|type:name|tag:name>]\n")
+		os.Exit(1)
+	}
+}
+
+// DoDue is "kp due", listing the entries overdue for rotation or due
+// within -days
+func DoDue(c *cli.CLI) {
+	within := FlagInt(c, "-days", DUE_SOON_DAYS)
+	due := DueEntries(LoadDB(), time.Now(), time.Duration(within)*24*time.Hour, HasFlag(c, "-a"))
+	if IsJSON(c) {
+		PrintJSONList(c, due)
+		return
+	}
+	if len(due) == 0 {
+		fmt.Printf("Nothing is due in the next %v.\n", pluralDays(within))
+		return
+	}
+	width := 0
+	for _, status := range due {
+		if len(status.Key) > width {
+			width = len(status.Key)
+		}
+	}
+	for _, status := range due {
+		state := "DUE"
+		if status.Overdue {
+			state = "OVERDUE"
+		}
+		fmt.Printf("%-7v  %-*v  %v (every %v, %v)\n", state, width, status.Key, status.Describe(), pluralDays(status.Days), status.Rule)
+	}
+}
+
+// WarnIfOverdue writes a warning to stderr when the entry is overdue
+func WarnIfOverdue(db *KPDB, entry DBEntry) {
+	if status, ok := db.GetData().RotationOf(entry, time.Now()); ok && status.Overdue {
+		fmt.Fprintf(os.Stderr, "Warning, '%v' is %v for rotation (every %v, %v).\n",
+			entry.Key, status.Describe(), pluralDays(status.Days), status.Rule)
+	}
+}
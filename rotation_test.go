@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotationInterval(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "prod/db", Value: "1", Type: "DB-Password", Tags: map[string]bool{"prod": true, "pci": true}})
+	db.Put(DBEntry{Key: "dev/db", Value: "2", Type: "db-password"})
+	db.Put(DBEntry{Key: "note", Value: "3"})
+	db.Put(DBEntry{Key: "legacy", Value: "4", Tags: map[string]bool{"Prod": true}})
+
+	for target, days := range map[string]int{"type:db-password": 90, "tag:prod": 30, "tag:pci": 60} {
+		if _, err := SetRotation(db, target, days); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := db.GetData()
+	expected := map[string]string{"prod/db": "tag:prod", "dev/db": "type:db-password", "note": "", "legacy": "tag:prod"}
+	for key, rule := range expected {
+		if _, got := data.RotationInterval(data.Entries[key]); got != rule {
+			t.Errorf("expected %v to rotate by %q, got %q", key, rule, got)
+		}
+	}
+
+	// an interval on the key wins, and setting it leaves LastUpdated alone
+	before := data.Entries["prod/db"].LastUpdated
+	if changed, err := SetRotation(db, "prod/", 7); err != nil || changed != 1 {
+		t.Fatalf("expected 1 key changed, got %v, %v", changed, err)
+	}
+	entry := data.Entries["prod/db"]
+	if days, rule := data.RotationInterval(entry); days != 7 || rule != "key" || !entry.LastUpdated.Equal(before) {
+		t.Fatalf("unexpected interval %v %v for %+v", days, rule, entry)
+	}
+
+	if _, err := SetRotation(db, "tag:missing", 0); err == nil {
+		t.Errorf("expected an error removing a rule that does not exist")
+	}
+	for _, target := range []string{"type:db-password", "tag:prod", "tag:pci"} {
+		SetRotation(db, target, 0)
+	}
+	if data.Rotation != nil || len(RotationList(db)) != 1 {
+		t.Fatalf("expected only the key's interval left, got %+v", RotationList(db))
+	}
+}
+
+func TestDueEntries(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	for key, age := range map[string]int{"overdue": 100, "soon": 85, "fresh": 10} {
+		db.Put(DBEntry{Key: key, Value: key, Type: "login"})
+		entry := db.GetData().Entries[key]
+		entry.LastUpdated = now.AddDate(0, 0, -age)
+		db.GetData().Entries[key] = entry
+	}
+	SetRotation(db, "type:login", 90)
+
+	due := DueEntries(db, now, DUE_SOON_DAYS*24*time.Hour, false)
+	if len(due) != 2 || due[0].Key != "overdue" || due[1].Key != "soon" {
+		t.Fatalf("unexpected due entries %+v", due)
+	}
+	if !due[0].Overdue || due[0].Describe() != "overdue by 10 days" || due[1].Overdue || due[1].Describe() != "due in 5 days" {
+		t.Fatalf("unexpected status %v, %v", due[0].Describe(), due[1].Describe())
+	}
+	if formatListDue(&due[0]) != "OVERDUE 10d" || formatListDue(nil) != "" {
+		t.Fatalf("unexpected due column %q", formatListDue(&due[0]))
+	}
+
+	// the rules are saved with the vault
+	db.Save()
+	loaded := NewKPDB(db.Filename, db.PrivateKeyFilename)
+	if days, _ := loaded.GetData().RotationInterval(loaded.GetData().Entries["fresh"]); days != 90 {
+		t.Fatalf("expected the rule to be saved, got %v", days)
+	}
+}
+
+func TestMergeRotationRules(t *testing.T) {
+	ours := &RotationRules{Tags: map[string]int{"prod": 30}}
+	theirs := &RotationRules{Tags: map[string]int{"prod": 60, "pci": 90}, Types: map[string]int{"login": 365}}
+	merged := MergeRotationRules(ours, theirs)
+	if merged.Tags["prod"] != 30 || merged.Tags["pci"] != 90 || merged.Types["login"] != 365 || len(ours.Tags) != 1 {
+		t.Fatalf("unexpected merge %+v", merged)
+	}
+	if MergeRotationRules(nil, nil) != nil {
+		t.Fatalf("expected no rules")
+	}
+}
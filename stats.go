@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// STATS_LARGEST is how many of the largest values kp stats lists
+const STATS_LARGEST = 5
+
+// STATS_AGES are the buckets entries are counted in by how long ago they
+// were last updated
+var STATS_AGES = []struct {
+	Label string
+	Under time.Duration
+}{
+	{"under 30 days", 30 * 24 * time.Hour},
+	{"30 to 90 days", 90 * 24 * time.Hour},
+	{"90 days to a year", 365 * 24 * time.Hour},
+	{"over a year", 0},
+}
+
+// StatCount is a name (a type, tag or age) and how many entries have it
+type StatCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ValueSize is the size in bytes of an entry's value
+type ValueSize struct {
+	Key   string `json:"key"`
+	Bytes int    `json:"bytes"`
+}
+
+// VaultStats is the kp stats report
+type VaultStats struct {
+	Filename        string      `json:"filename"`
+	FileBytes       int64       `json:"fileBytes"`
+	Entries         int         `json:"entries"`
+	Visible         int         `json:"visible"`
+	Hidden          int         `json:"hidden"`
+	History         int         `json:"history"`
+	ByType          []StatCount `json:"byType"`
+	ByTag           []StatCount `json:"byTag"`
+	Untagged        int         `json:"untagged"`
+	Ages            []StatCount `json:"ages"`
+	MissingUrl      []string    `json:"missingUrl"`
+	MissingUsername []string    `json:"missingUsername"`
+	Largest         []ValueSize `json:"largest"`
+	Undecryptable   []string    `json:"undecryptable"`
+}
+
+// CollectStats works out the report for a vault. Values are decrypted one
+// at a time to be measured; one that cannot be is listed as undecryptable
+// instead.
+func CollectStats(db *KPDB, now time.Time) VaultStats {
+	stats := VaultStats{
+		Filename:        db.Filename,
+		History:         len(db.GetData().History),
+		MissingUrl:      make([]string, 0),
+		MissingUsername: make([]string, 0),
+		Largest:         make([]ValueSize, 0),
+		Undecryptable:   make([]string, 0),
+	}
+	if info, err := os.Stat(db.Filename); err == nil {
+		stats.FileBytes = info.Size()
+	}
+
+	types := make(map[string]int)
+	tags := make(map[string]int)
+	ages := make(map[string]int)
+	for _, entry := range db.GetEntriesSortedByUpdatedThenKey() {
+		stats.Entries++
+		if entry.Hidden {
+			stats.Hidden++
+		} else {
+			stats.Visible++
+		}
+		types[entry.Type]++
+		for _, tag := range entry.TagList() {
+			tags[tag]++
+		}
+		if len(entry.TagList()) == 0 {
+			stats.Untagged++
+		}
+		ages[statsAge(entry.LastUpdated, now)]++
+		if entry.Url == "" {
+			stats.MissingUrl = append(stats.MissingUrl, entry.Key)
+		}
+		if entry.Username == "" {
+			stats.MissingUsername = append(stats.MissingUsername, entry.Key)
+		}
+		value, err := db.Decrypt(entry.Value)
+		if err != nil {
+			stats.Undecryptable = append(stats.Undecryptable, entry.Key)
+			continue
+		}
+		stats.Largest = append(stats.Largest, ValueSize{Key: entry.Key, Bytes: len(value)})
+	}
+
+	stats.ByType = sortedCounts(types)
+	stats.ByTag = sortedCounts(tags)
+	stats.Ages = make([]StatCount, 0)
+	for _, age := range STATS_AGES {
+		stats.Ages = append(stats.Ages, StatCount{Name: age.Label, Count: ages[age.Label]})
+	}
+	sort.SliceStable(stats.Largest, func(a int, b int) bool {
+		return stats.Largest[a].Bytes > stats.Largest[b].Bytes
+	})
+	if len(stats.Largest) > STATS_LARGEST {
+		stats.Largest = stats.Largest[:STATS_LARGEST]
+	}
+	return stats
+}
+
+func statsAge(updated time.Time, now time.Time) string {
+	for _, age := range STATS_AGES {
+		if age.Under == 0 || now.Sub(updated) < age.Under {
+			return age.Label
+		}
+	}
+	return ""
+}
+
+// sortedCounts orders counts most first, then by name
+func sortedCounts(counts map[string]int) []StatCount {
+	result := make([]StatCount, 0)
+	for name, count := range counts {
+		result = append(result, StatCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(a int, b int) bool {
+		if result[a].Count != result[b].Count {
+			return result[a].Count > result[b].Count
+		}
+		return result[a].Name < result[b].Name
+	})
+	return result
+}
+
+// FormatBytes is a size in B, KB or MB
+func FormatBytes(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%v B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
+
+// Print writes the report as a set of tables
+func (s VaultStats) Print() {
+	fmt.Printf("Vault    : %v (%v)\n", s.Filename, FormatBytes(s.FileBytes))
+	fmt.Printf("Entries  : %v (%v visible, %v hidden)\n", s.Entries, s.Visible, s.Hidden)
+	fmt.Printf("History  : %v\n", s.History)
+
+	// the names line up, however long the longest is
+	width := 20
+	for _, counts := range [][]StatCount{s.ByType, s.ByTag} {
+		for _, count := range counts {
+			width = goutils.Max(width, len(count.Name))
+		}
+	}
+	for _, value := range s.Largest {
+		width = goutils.Max(width, len(value.Key))
+	}
+
+	printCounts := func(title string, counts []StatCount) {
+		fmt.Printf("\n%v\n", title)
+		for _, count := range counts {
+			name := count.Name
+			if name == "" {
+				name = "(none)"
+			}
+			fmt.Printf("  %v %5d\n", goutils.RPadToFixedLength(name, " ", width), count.Count)
+		}
+	}
+	printCounts("By type", s.ByType)
+	printCounts("By tag", append(s.ByTag, StatCount{Name: "", Count: s.Untagged}))
+	printCounts("Last updated", s.Ages)
+
+	printKeys := func(title string, keys []string) {
+		fmt.Printf("\n%v (%v)\n", title, len(keys))
+		if len(keys) > 0 {
+			fmt.Printf("  %v\n", strings.Join(keys, ", "))
+		}
+	}
+	printKeys("Missing url", s.MissingUrl)
+	printKeys("Missing username", s.MissingUsername)
+
+	fmt.Printf("\nLargest values\n")
+	for _, value := range s.Largest {
+		fmt.Printf("  %v %8v\n", goutils.RPadToFixedLength(value.Key, " ", width), FormatBytes(int64(value.Bytes)))
+	}
+	if len(s.Undecryptable) > 0 {
+		printKeys("Cannot decrypt", s.Undecryptable)
+	}
+}
+
+// DoStats is "kp stats"
+func DoStats(c *cli.CLI) {
+	stats := CollectStats(LoadDB(), time.Now())
+	if IsJSON(c) {
+		PrintJSON(c, stats)
+		return
+	}
+	stats.Print()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectStats(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "github", Value: "short", Type: "login", Url: "https://github.com", Username: "bob", Tags: map[string]bool{"work": true}})
+	db.Put(DBEntry{Key: "cert", Value: strings.Repeat("x", 600), Type: "file", Hidden: true})
+	db.Put(DBEntry{Key: "aws", Value: "key", Type: "login", Tags: map[string]bool{"work": true, "prod": true}})
+	db.Save()
+
+	stats := CollectStats(db, time.Now().Add(100*24*time.Hour))
+	if stats.Entries != 3 || stats.Visible != 2 || stats.Hidden != 1 || stats.Untagged != 1 || stats.FileBytes == 0 {
+		t.Fatalf("unexpected counts %+v", stats)
+	}
+	if stats.ByType[0] != (StatCount{Name: "login", Count: 2}) || stats.ByTag[0] != (StatCount{Name: "work", Count: 2}) {
+		t.Fatalf("unexpected type and tag counts %+v %+v", stats.ByType, stats.ByTag)
+	}
+	if stats.Ages[2].Count != 3 {
+		t.Fatalf("expected every entry to be 90 days to a year old, got %+v", stats.Ages)
+	}
+	if strings.Join(stats.MissingUrl, ",") != "aws,cert" || strings.Join(stats.MissingUsername, ",") != "aws,cert" {
+		t.Fatalf("unexpected missing %v %v", stats.MissingUrl, stats.MissingUsername)
+	}
+	if stats.Largest[0] != (ValueSize{Key: "cert", Bytes: 600}) {
+		t.Fatalf("unexpected largest %+v", stats.Largest)
+	}
+
+	// a value that cannot be decrypted is listed rather than measured
+	entry := db.GetData().Entries["cert"]
+	entry.Value = strings.Repeat("y", 2000)
+	db.GetData().Entries["cert"] = entry
+	stats = CollectStats(db, time.Now())
+	if len(stats.Undecryptable) != 1 || stats.Undecryptable[0] != "cert" || stats.Largest[0].Key == "cert" || len(stats.Largest) != 2 {
+		t.Fatalf("expected cert to be undecryptable, got %v %+v", stats.Undecryptable, stats.Largest)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// COMMON_PASSWORDS are found inside values as well as the EFF words
+var COMMON_PASSWORDS = []string{
+	"password", "passw0rd", "letmein", "welcome", "admin", "root", "qwerty", "iloveyou", "monkey",
+	"dragon", "master", "secret", "login", "abc123", "trustno1", "football", "baseball", "sunshine",
+	"shadow", "princess", "superman", "changeme", "default", "hello",
+}
+
+// KEYBOARD_ROWS are read as sequences, like "abc" and "123"
+var KEYBOARD_ROWS = []string{"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'", "zxcvbnm,./"}
+
+// the shortest repeat, sequence or dictionary word that counts as a pattern
+const (
+	MIN_PATTERN_LENGTH = 3
+	MIN_WORD_LENGTH    = 4
+)
+
+// Strength is an estimate of how hard a value is to guess
+type Strength struct {
+	Entropy  float64  `json:"entropy"`  // in bits
+	Patterns []string `json:"patterns"` // what made it weaker, e.g. word "password"
+}
+
+// characterPool is how many characters each one in the value could have
+// been, from the classes it uses
+func characterPool(value string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	return pool
+}
+
+// pattern is a part of a value that is easier to guess than its length
+// suggests, and how many bits guessing it takes
+type pattern struct {
+	start, end int
+	bits       float64
+	name       string
+}
+
+// EstimateStrength works out the entropy of a value: characters that are
+// part of no pattern count for the size of the character pool, while a
+// dictionary word counts for the size of the dictionary and a repeat or a
+// sequence counts for little more than its first character
+func EstimateStrength(value string) Strength {
+	runes := []rune(value)
+	lowered := []rune(strings.ToLower(value))
+	if len(lowered) != len(runes) {
+		lowered = runes
+	}
+	perCharacter := math.Log2(float64(characterPool(value)))
+	patterns := make([]pattern, 0)
+	patterns = append(patterns, findWords(lowered)...)
+	patterns = append(patterns, findRepeats(lowered, perCharacter)...)
+	patterns = append(patterns, findSequences(lowered, perCharacter)...)
+
+	// the longest patterns win where they overlap
+	sort.SliceStable(patterns, func(a int, b int) bool {
+		return patterns[a].end-patterns[a].start > patterns[b].end-patterns[b].start
+	})
+	covered := make([]bool, len(runes))
+	strength := Strength{Patterns: make([]string, 0)}
+	for _, p := range patterns {
+		free := true
+		for i := p.start; i < p.end; i++ {
+			free = free && !covered[i]
+		}
+		if !free {
+			continue
+		}
+		for i := p.start; i < p.end; i++ {
+			covered[i] = true
+		}
+		strength.Entropy += p.bits
+		strength.Patterns = append(strength.Patterns, fmt.Sprintf("%v %q", p.name, string(runes[p.start:p.end])))
+	}
+	for _, c := range covered {
+		if !c {
+			strength.Entropy += perCharacter
+		}
+	}
+	return strength
+}
+
+// unleet undoes the usual substitutions (p4ssw0rd), a character for a character
+var unleet = strings.NewReplacer("0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// findWords finds common passwords and the longer words of the EFF wordlist,
+// as they are or with letters swapped for look-alike digits and symbols
+func findWords(text []rune) []pattern {
+	patterns := make([]pattern, 0)
+	find := func(text string, words []string, bits float64, name string) {
+		for _, word := range words {
+			if len(word) < MIN_WORD_LENGTH {
+				continue
+			}
+			for offset := 0; ; {
+				index := strings.Index(text[offset:], word)
+				if index < 0 {
+					break
+				}
+				start := len([]rune(text[:offset+index]))
+				patterns = append(patterns, pattern{start, start + len([]rune(word)), bits, name})
+				offset += index + len(word)
+			}
+		}
+	}
+	for _, variant := range []string{string(text), unleet.Replace(string(text))} {
+		find(variant, COMMON_PASSWORDS, math.Log2(float64(len(COMMON_PASSWORDS))), "common password")
+		find(variant, Wordlist(), math.Log2(float64(len(Wordlist()))), "word")
+	}
+	return patterns
+}
+
+// findRepeats finds runs of the same character, e.g. "aaaa"
+func findRepeats(text []rune, perCharacter float64) []pattern {
+	patterns := make([]pattern, 0)
+	for start := 0; start < len(text); {
+		end := start + 1
+		for end < len(text) && text[end] == text[start] {
+			end++
+		}
+		if end-start >= MIN_PATTERN_LENGTH {
+			patterns = append(patterns, pattern{start, end, perCharacter + math.Log2(float64(end-start)), "repeat"})
+		}
+		start = end
+	}
+	return patterns
+}
+
+// findSequences finds runs such as "abcd", "4321" and "qwerty"
+func findSequences(text []rune, perCharacter float64) []pattern {
+	keyboard := make(map[rune][2]int)
+	for row, keys := range KEYBOARD_ROWS {
+		for column, key := range []rune(keys) {
+			keyboard[key] = [2]int{row, column}
+		}
+	}
+	// step is 1 or -1 when b follows a in the alphabet, digits or on the
+	// keyboard, and 0 otherwise
+	step := func(a rune, b rune) int {
+		sameClass := (unicode.IsLetter(a) && unicode.IsLetter(b)) || (unicode.IsDigit(a) && unicode.IsDigit(b))
+		if sameClass && (b-a == 1 || a-b == 1) {
+			return int(b - a)
+		}
+		ka, okA := keyboard[a]
+		kb, okB := keyboard[b]
+		if okA && okB && ka[0] == kb[0] && (kb[1]-ka[1] == 1 || ka[1]-kb[1] == 1) {
+			return kb[1] - ka[1]
+		}
+		return 0
+	}
+	patterns := make([]pattern, 0)
+	for start := 0; start < len(text); {
+		end := start + 1
+		if end < len(text) {
+			if direction := step(text[start], text[end]); direction != 0 {
+				for end < len(text) && step(text[end-1], text[end]) == direction {
+					end++
+				}
+			}
+		}
+		if end-start >= MIN_PATTERN_LENGTH {
+			patterns = append(patterns, pattern{start, end, perCharacter + math.Log2(float64(end-start)), "sequence"})
+			start = end
+		} else {
+			start++
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cli "github.com/simonski/cli"
+	goutils "github.com/simonski/goutils"
+)
+
+// KP_SYNC_DIR the key for the env var pointing to the git checkout kp syncs
+// the vault through
+const KP_SYNC_DIR = "KP_SYNC_DIR"
+
+const DEFAULT_SYNC_DIR = "~/.kp-sync"
+
+// the file and branch the vault is kept in
+const (
+	SYNC_FILE   = "kpfile"
+	SYNC_REMOTE = "origin"
+	SYNC_BRANCH = "main"
+)
+
+// how the local and remote vaults were brought together
+const (
+	SYNC_UP_TO_DATE   = "up to date"
+	SYNC_FAST_FORWARD = "fast-forward"
+	SYNC_MERGED       = "merged"
+)
+
+var ErrSyncNotInitialised = errors.New("sync is not set up, run 'kp sync init <remote>'")
+
+// GitRepo runs git in a directory
+type GitRepo struct {
+	Dir string
+}
+
+// Run runs git with the args, returning its (trimmed) output
+func (r GitRepo) Run(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Exists is true when the directory is a git checkout
+func (r GitRepo) Exists() bool {
+	_, err := os.Stat(filepath.Join(r.Dir, ".git"))
+	return err == nil
+}
+
+// RunAs runs a git command that records an author (commit, merge), as "kp"
+// when git has no identity set up
+func (r GitRepo) RunAs(args ...string) (string, error) {
+	if email, _ := r.Run("config", "user.email"); email == "" {
+		host, _ := os.Hostname()
+		args = append([]string{"-c", "user.name=kp", "-c", "user.email=kp@" + host}, args...)
+	}
+	return r.Run(args...)
+}
+
+// Commit commits what is staged
+func (r GitRepo) Commit(message string) error {
+	_, err := r.RunAs("commit", "-q", "-m", message)
+	return err
+}
+
+// SyncResult is what a sync did
+type SyncResult struct {
+	Committed bool
+	Merge     string
+	Summary   ImportSummary
+}
+
+// SyncInit makes dir a git checkout with the remote, ready for Sync
+func SyncInit(dir string, remote string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	repo := GitRepo{Dir: dir}
+	if repo.Exists() {
+		_, err := repo.Run("remote", "set-url", SYNC_REMOTE, remote)
+		return err
+	}
+	if _, err := repo.Run("init", "-q"); err != nil {
+		return err
+	}
+	if _, err := repo.Run("symbolic-ref", "HEAD", "refs/heads/"+SYNC_BRANCH); err != nil {
+		return err
+	}
+	_, err := repo.Run("remote", "add", SYNC_REMOTE, remote)
+	return err
+}
+
+// Sync commits the vault to the checkout in dir, fetches, merges the remote
+// vault entry by entry (conflicts go to strategy, see MergeResolver) and
+// pushes. The vault is only saved once the merge is committed, and then
+// atomically.
+func Sync(db *KPDB, dir string, strategy string) (SyncResult, error) {
+	result := SyncResult{Merge: SYNC_UP_TO_DATE}
+	repo := GitRepo{Dir: dir}
+	if !repo.Exists() {
+		return result, ErrSyncNotInitialised
+	}
+	filename := filepath.Join(dir, SYNC_FILE)
+
+	if err := WriteFileAtomic(filename, MarshalDB(db.GetData()), 0600); err != nil {
+		return result, err
+	}
+	if _, err := repo.Run("add", SYNC_FILE); err != nil {
+		return result, err
+	}
+	if status, err := repo.Run("status", "--porcelain", "--", SYNC_FILE); err != nil {
+		return result, err
+	} else if status != "" {
+		host, _ := os.Hostname()
+		if err := repo.Commit("kp sync from " + host); err != nil {
+			return result, err
+		}
+		result.Committed = true
+	}
+
+	if _, err := repo.Run("fetch", "-q", SYNC_REMOTE); err != nil {
+		return result, err
+	}
+	remoteBranch := SYNC_REMOTE + "/" + SYNC_BRANCH
+	if _, err := repo.Run("rev-parse", "-q", "--verify", remoteBranch); err == nil {
+		if _, err := repo.Run("merge-base", "--is-ancestor", remoteBranch, "HEAD"); err != nil {
+			if _, err := repo.Run("merge-base", "--is-ancestor", "HEAD", remoteBranch); err == nil {
+				result.Merge = SYNC_FAST_FORWARD
+				err = syncFastForward(db, repo, remoteBranch)
+				if err != nil {
+					return result, err
+				}
+			} else {
+				result.Merge = SYNC_MERGED
+				result.Summary, err = syncMerge(db, repo, remoteBranch, strategy)
+				if err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+
+	if _, err := repo.Run("push", "-q", SYNC_REMOTE, "HEAD:"+SYNC_BRANCH); err != nil {
+		return result, fmt.Errorf("%v (the remote may have changed, run 'kp sync' again)", err)
+	}
+	return result, nil
+}
+
+// syncFastForward takes the remote vault as it is, as it already has every
+// local change
+func syncFastForward(db *KPDB, repo GitRepo, remoteBranch string) error {
+	data, err := repo.Run("show", remoteBranch+":"+SYNC_FILE)
+	if err != nil {
+		return err
+	}
+	remote, err := ParseDB([]byte(data))
+	if err != nil {
+		return fmt.Errorf("the remote vault is not valid: %v", err)
+	}
+	if _, err := repo.RunAs("merge", "-q", "--ff-only", remoteBranch); err != nil {
+		return err
+	}
+	db.data = remote
+	if !db.Save() {
+		return fmt.Errorf("could not save %v", db.Filename)
+	}
+	return nil
+}
+
+// syncMerge merges the remote vault into the local one with kp's own merge,
+// recording it as a git merge whose tree is the merged vault
+func syncMerge(db *KPDB, repo GitRepo, remoteBranch string, strategy string) (ImportSummary, error) {
+	summary := ImportSummary{}
+	data, err := repo.Run("show", remoteBranch+":"+SYNC_FILE)
+	if err != nil {
+		return summary, err
+	}
+	remote, err := ParseDB([]byte(data))
+	if err != nil {
+		return summary, fmt.Errorf("the remote vault is not valid: %v", err)
+	}
+	ours, err := decryptEntries(db)
+	if err != nil {
+		return summary, err
+	}
+	theirs, err := decryptEntries(&KPDB{data: remote, Filename: remoteBranch, PrivateKeyFilename: db.PrivateKeyFilename})
+	if err != nil {
+		return summary, err
+	}
+
+	plan := PlanMerge(ours, theirs, db.GetData().Deleted, remote.Deleted)
+	resolve, err := MergeResolver(plan, strategy)
+	if err != nil {
+		return summary, err
+	}
+	merged := &KPDB{data: cloneDB(db.GetData()), Filename: db.Filename, PrivateKeyFilename: db.PrivateKeyFilename}
+	merged.GetData().Rotation = MergeRotationRules(db.GetData().Rotation, remote.Rotation)
+	summary = ApplyMerge(merged, plan, resolve, false)
+
+	if _, err := repo.RunAs("merge", "-q", "--no-commit", "--allow-unrelated-histories", "-s", "ours", remoteBranch); err != nil {
+		return summary, err
+	}
+	abort := func(err error) (ImportSummary, error) {
+		repo.Run("merge", "--abort")
+		return summary, err
+	}
+	if err := WriteFileAtomic(filepath.Join(repo.Dir, SYNC_FILE), MarshalDB(merged.GetData()), 0600); err != nil {
+		return abort(err)
+	}
+	if _, err := repo.Run("add", SYNC_FILE); err != nil {
+		return abort(err)
+	}
+	host, _ := os.Hostname()
+	if err := repo.Commit("kp sync merge on " + host); err != nil {
+		return abort(err)
+	}
+	db.data = merged.GetData()
+	if !db.Save() {
+		return summary, fmt.Errorf("could not save %v", db.Filename)
+	}
+	return summary, nil
+}
+
+// SyncedVault is the vault as it was committed to the sync checkout in dir
+// at rev, any git revision (HEAD~3, a commit from "git log")
+func SyncedVault(dir string, rev string, key string) (*KPDB, error) {
+	repo := GitRepo{Dir: dir}
+	if !repo.Exists() {
+		return nil, ErrSyncNotInitialised
+	}
+	data, err := repo.Run("show", rev+":"+SYNC_FILE)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := ParseDB([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("the vault at %v is not valid: %v", rev, err)
+	}
+	return &KPDB{data: vault, Filename: rev, PrivateKeyFilename: key}, nil
+}
+
+// cloneDB copies the entries, history, rotation rules and deletions so a
+// merge can be thrown away
+func cloneDB(db *DB) *DB {
+	clone := NewDB()
+	clone.Version = db.Version
+	for key, entry := range db.Entries {
+		clone.Entries[key] = entry
+	}
+	for key, entry := range db.History {
+		clone.History[key] = entry
+	}
+	clone.Rotation = db.Rotation.clone()
+	for key, deleted := range db.Deleted {
+		if clone.Deleted == nil {
+			clone.Deleted = make(map[string]time.Time)
+		}
+		clone.Deleted[key] = deleted
+	}
+	return clone
+}
+
+// DoSync is "kp sync" and "kp sync init <remote>"
+func DoSync(c *cli.CLI) {
+	dir := goutils.EvaluateFilename(cli.GetEnvOrDefault(KP_SYNC_DIR, DEFAULT_SYNC_DIR))
+	strategy := FlagString(c, "-strategy", "")
+	if strategy != "" && !contains(MERGE_STRATEGIES, strategy) {
+		fmt.Printf("Error, -strategy must be one of %v.\n", MERGE_STRATEGIES)
+		os.Exit(1)
+	}
+
+	positionals := Positionals(c)
+	if len(positionals) > 0 {
+		if positionals[0] != "init" || len(positionals) < 2 {
+			fmt.Printf("Usage: kp sync [init <remote>]\n")
+			os.Exit(1)
+		}
+		if err := SyncInit(dir, positionals[1]); err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Syncing %v through %v.\n", dir, positionals[1])
+	}
+
+	db := LoadDB()
+	result, err := Sync(db, dir, strategy)
+	if err != nil {
+		fmt.Printf("Error, %v\n", err)
+		os.Exit(1)
+	}
+	if result.Merge == SYNC_MERGED {
+		result.Summary.Print()
+	}
+	fmt.Printf("Synced (%v).\n", result.Merge)
+}
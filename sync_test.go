@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	laptop := newTestDB(t)
+	desktop := NewKPDB(filepath.Join(t.TempDir(), "kpfile"), laptop.PrivateKeyFilename)
+	laptopDir := filepath.Join(t.TempDir(), "sync")
+	desktopDir := filepath.Join(t.TempDir(), "sync")
+
+	laptop.Put(DBEntry{Key: "shared", Value: "v1"})
+	mustSync := func(db *KPDB, dir string, merge string) {
+		t.Helper()
+		if !(GitRepo{Dir: dir}).Exists() {
+			if err := SyncInit(dir, remote); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result, err := Sync(db, dir, MERGE_NEWEST)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Merge != merge {
+			t.Fatalf("expected %v, got %v", merge, result.Merge)
+		}
+	}
+	mustSync(laptop, laptopDir, SYNC_UP_TO_DATE)
+
+	desktop.Put(DBEntry{Key: "desktop", Value: "d"})
+	mustSync(desktop, desktopDir, SYNC_MERGED)
+	if e, _ := desktop.GetDecrypted("shared"); e.Value != "v1" {
+		t.Fatalf("expected the laptop's entry on the desktop, got %+v", e)
+	}
+
+	mustSync(laptop, laptopDir, SYNC_FAST_FORWARD)
+	if e, _ := laptop.GetDecrypted("desktop"); e.Value != "d" {
+		t.Fatalf("expected the desktop's entry on the laptop, got %+v", e)
+	}
+
+	laptop.Put(DBEntry{Key: "laptop", Value: "l"})
+	mustSync(laptop, laptopDir, SYNC_UP_TO_DATE)
+	desktop.Put(DBEntry{Key: "shared", Value: "v2"})
+	mustSync(desktop, desktopDir, SYNC_MERGED)
+	if e, _ := desktop.GetDecrypted("laptop"); e.Value != "l" {
+		t.Fatalf("expected the laptop's new entry, got %+v", e)
+	}
+	if e, _ := desktop.GetDecrypted("shared"); e.Value != "v2" {
+		t.Fatalf("expected the desktop's change to be kept, got %+v", e)
+	}
+
+	saved := NewKPDB(desktop.Filename, desktop.PrivateKeyFilename)
+	if len(saved.GetData().Entries) != 3 {
+		t.Fatalf("expected the merged vault to be saved, got %v entries", len(saved.GetData().Entries))
+	}
+
+	// keys removed or moved on one side stay gone after a merge
+	mustSync(laptop, laptopDir, SYNC_FAST_FORWARD)
+	laptop.Delete("desktop")
+	if _, err := MoveKeys(laptop, "laptop", "work/laptop"); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(laptop, laptopDir, SYNC_UP_TO_DATE)
+	desktop.Put(DBEntry{Key: "other", Value: "o"})
+	mustSync(desktop, desktopDir, SYNC_MERGED)
+	for _, key := range []string{"desktop", "laptop"} {
+		if _, exists := desktop.GetData().Entries[key]; exists {
+			t.Fatalf("expected '%v' to stay deleted", key)
+		}
+	}
+	if e, _ := desktop.GetDecrypted("work/laptop"); e.Value != "l" {
+		t.Fatalf("expected the moved entry, got %+v", e)
+	}
+}
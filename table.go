@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ListColumn is a column kp ls can show
+type ListColumn struct {
+	Name   string
+	Header string
+	Value  func(entry DBEntry, row ListRow) string
+	Fixed  bool // never narrowed to fit the terminal
+}
+
+// ListRow is what a column needs besides the entry
+type ListRow struct {
+	Dates    string          // the layout of dates
+	Rotation *RotationStatus // nil when the entry has no rotation interval
+}
+
+// LIST_COLUMNS are the columns kp ls can show, in their default order
+var LIST_COLUMNS = []ListColumn{
+	{"key", "Key", func(e DBEntry, _ ListRow) string { return e.Key }, false},
+	{"username", "Username", func(e DBEntry, _ ListRow) string { return e.Username }, false},
+	{"url", "Url", func(e DBEntry, _ ListRow) string { return e.Url }, false},
+	{"type", "Type", func(e DBEntry, _ ListRow) string { return e.Type }, false},
+	{"tags", "Tags", func(e DBEntry, _ ListRow) string { return strings.Join(e.TagList(), ",") }, false},
+	{"description", "Description", func(e DBEntry, _ ListRow) string { return e.Description }, false},
+	{"notes", "Notes", func(e DBEntry, _ ListRow) string { return e.Notes }, false},
+	{"created", "Created", func(e DBEntry, row ListRow) string { return formatListDate(e.Created, row.Dates) }, true},
+	{"updated", "Updated", func(e DBEntry, row ListRow) string { return formatListDate(e.LastUpdated, row.Dates) }, true},
+	{"due", "Due", func(_ DBEntry, row ListRow) string { return formatListDue(row.Rotation) }, true},
+}
+
+// LIST_DEFAULT_COLUMNS are shown unless -columns says otherwise
+var LIST_DEFAULT_COLUMNS = []string{"key", "username", "url", "type", "tags", "description", "notes", "created", "updated"}
+
+// LIST_DUE_COLUMN is added to the default columns when any entry listed has
+// a rotation interval, marking the overdue ones
+const LIST_DUE_COLUMN = "due"
+
+// LIST_COMPACT_COLUMNS are shown in compact mode
+var LIST_COMPACT_COLUMNS = []string{"key", "username", "tags", "updated"}
+
+// LIST_COMPACT_WIDTH is the terminal width below which kp ls is compact
+const LIST_COMPACT_WIDTH = 80
+
+// LIST_MIN_WIDTH is as narrow as a column is squeezed to fit the terminal
+const LIST_MIN_WIDTH = 5
+
+// LIST_SORTS are the orders kp ls -sort accepts
+var LIST_SORTS = []string{"key", "created", "updated", "type"}
+
+func formatListDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// formatListDue is "OVERDUE 12d", "in 3d" or "" with no interval
+func formatListDue(status *RotationStatus) string {
+	switch {
+	case status == nil:
+		return ""
+	case status.Overdue:
+		return fmt.Sprintf("OVERDUE %vd", -status.DaysLeft)
+	default:
+		return fmt.Sprintf("in %vd", status.DaysLeft)
+	}
+}
+
+// ParseListColumns turns "key,username,url" into columns
+func ParseListColumns(names string) ([]ListColumn, error) {
+	columns := make([]ListColumn, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, column := range LIST_COLUMNS {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+			}
+		}
+		if !found {
+			valid := make([]string, 0)
+			for _, column := range LIST_COLUMNS {
+				valid = append(valid, column.Name)
+			}
+			return nil, fmt.Errorf("unknown column '%v', the columns are %v", name, strings.Join(valid, ", "))
+		}
+	}
+	return columns, nil
+}
+
+// SortEntries orders entries by key or type (A to Z) or by created or
+// updated (newest first); ties are in key order. An empty by keeps the
+// order they are in (a search's ranking), only reversing it.
+func SortEntries(entries []DBEntry, by string, reverse bool) error {
+	var less func(a DBEntry, b DBEntry) bool
+	switch by {
+	case "":
+		for i, j := 0, len(entries)-1; reverse && i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+		return nil
+	case "key":
+		less = func(a DBEntry, b DBEntry) bool { return false }
+	case "type":
+		less = func(a DBEntry, b DBEntry) bool { return strings.ToLower(a.Type) < strings.ToLower(b.Type) }
+	case "created":
+		less = func(a DBEntry, b DBEntry) bool { return a.Created.After(b.Created) }
+	case "updated":
+		less = func(a DBEntry, b DBEntry) bool { return a.LastUpdated.After(b.LastUpdated) }
+	default:
+		return fmt.Errorf("cannot sort by '%v', use one of %v", by, strings.Join(LIST_SORTS, ", "))
+	}
+	sort.SliceStable(entries, func(i int, j int) bool {
+		a, b := entries[i], entries[j]
+		if reverse {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return strings.ToLower(a.Key) < strings.ToLower(b.Key)
+	})
+	return nil
+}
+
+// FitColumns works out how wide each column is: as wide as its longest
+// cell, with the widest (not fixed) columns narrowed in turn until the table
+// and its separators fit in maxWidth. A maxWidth of 0 is no limit.
+func FitColumns(cells [][]string, fixed []bool, separators int, maxWidth int) []int {
+	if len(cells) == 0 {
+		return []int{}
+	}
+	widths := make([]int, len(cells[0]))
+	for _, row := range cells {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if maxWidth <= 0 {
+		return widths
+	}
+	for {
+		total := separators
+		widest := -1
+		for i, width := range widths {
+			total += width
+			if !fixed[i] && width > LIST_MIN_WIDTH && (widest < 0 || width > widths[widest]) {
+				widest = i
+			}
+		}
+		if total <= maxWidth || widest < 0 {
+			return widths
+		}
+		widths[widest]--
+	}
+}
+
+// FitCell cuts text to width (ending it with "…") or pads it out to width
+func FitCell(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		if width < 1 {
+			return ""
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// singleLine keeps multi-line notes to one row of the table
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// HighlightCell is FitCell(singleLine(text), width) with the runes at
+// positions in text highlighted. The positions are moved to where the runes
+// end up once the whitespace is folded, and any folded away or cut off are
+// dropped.
+func HighlightCell(text string, positions []int, width int, start string, end string) string {
+	moved := make([]int, len([]rune(text)))
+	next, space := 0, false
+	for i, r := range []rune(text) {
+		moved[i] = -1
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && next > 0 {
+			next++
+		}
+		moved[i], space = next, false
+		next++
+	}
+
+	line := singleLine(text)
+	visible := len([]rune(line))
+	if visible > width {
+		visible = width - 1
+	}
+	kept := make([]int, 0)
+	for _, pos := range positions {
+		if pos >= 0 && pos < len(moved) && moved[pos] >= 0 && moved[pos] < visible {
+			kept = append(kept, moved[pos])
+		}
+	}
+	return Highlight(FitCell(line, width), kept, start, end)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortEntries(t *testing.T) {
+	now := time.Now()
+	entries := []DBEntry{
+		{Key: "b", Type: "login", Created: now.Add(-time.Hour)},
+		{Key: "A", Type: "note", Created: now},
+		{Key: "c", Type: "login", Created: now.Add(-2 * time.Hour)},
+	}
+	order := func() string {
+		keys := ""
+		for _, e := range entries {
+			keys += e.Key
+		}
+		return keys
+	}
+	expected := map[string]string{"key": "Abc", "type": "bcA", "created": "Abc"}
+	for by, keys := range expected {
+		if err := SortEntries(entries, by, false); err != nil || order() != keys {
+			t.Errorf("sorting by %v gave %v, expected %v", by, order(), keys)
+		}
+	}
+	SortEntries(entries, "created", true)
+	if order() != "cbA" {
+		t.Errorf("reverse created gave %v", order())
+	}
+	// no sort keeps the order (a search ranking), reversed with -reverse
+	SortEntries(entries, "", true)
+	if order() != "Abc" {
+		t.Errorf("reverse ranking gave %v", order())
+	}
+	if err := SortEntries(entries, "size", false); err == nil {
+		t.Errorf("expected an unknown sort to fail")
+	}
+}
+
+func TestFitColumns(t *testing.T) {
+	cells := [][]string{
+		{"Key", "Description", "Updated"},
+		{"github", "a very long description of the key", "2024-01-01"},
+	}
+	fixed := []bool{false, false, true}
+	widths := FitColumns(cells, fixed, 4, 0)
+	if widths[0] != 6 || widths[1] != 34 || widths[2] != 10 {
+		t.Fatalf("unexpected natural widths %v", widths)
+	}
+	widths = FitColumns(cells, fixed, 4, 30)
+	if widths[0]+widths[1]+widths[2]+4 != 30 || widths[2] != 10 {
+		t.Fatalf("unexpected fitted widths %v", widths)
+	}
+	if cell := FitCell(cells[1][1], widths[1]); len([]rune(cell)) != widths[1] {
+		t.Fatalf("unexpected cell %q", cell)
+	}
+	if cell := FitCell("ab", 4); cell != "ab  " {
+		t.Fatalf("unexpected padded cell %q", cell)
+	}
+}
+
+func TestParseListColumns(t *testing.T) {
+	columns, err := ParseListColumns("key, Tags,updated")
+	if err != nil || len(columns) != 3 || columns[1].Name != "tags" {
+		t.Fatalf("unexpected columns %+v %v", columns, err)
+	}
+	if _, err := ParseListColumns("key,size"); err == nil {
+		t.Fatalf("expected an unknown column to fail")
+	}
+}
+
+func TestHighlightCell(t *testing.T) {
+	notes := "first  line\n\tsecond line"
+	score, positions, ok := FuzzyMatch("second", notes, false)
+	if !ok || score == 0 {
+		t.Fatalf("expected a match")
+	}
+	if cell := HighlightCell(notes, positions, 30, "[", "]"); cell != "first line [s][e][c][o][n][d] line        " {
+		t.Fatalf("unexpected cell %q", cell)
+	}
+	// the matched runes cut off by the ellipsis are not highlighted
+	if cell := HighlightCell(notes, positions, 14, "[", "]"); cell != "first line [s][e]…" {
+		t.Fatalf("unexpected cut cell %q", cell)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	cli "github.com/simonski/cli"
+)
+
+// MAX_TAG_LENGTH is the longest tag name allowed
+const MAX_TAG_LENGTH = 64
+
+// validTag is what a tag looks like once normalized: lower case letters and
+// digits, with . _ / - after the first character
+var validTag = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}][\p{Ll}\p{Lo}\p{N}._/-]*$`)
+
+// NormalizeTag lower-cases a tag and joins its words with "-" ("Work Laptop"
+// becomes "work-laptop"), failing for names that are still not valid
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.Join(strings.FieldsFunc(strings.ToLower(tag), unicode.IsSpace), "-")
+	if normalized == "" {
+		return "", fmt.Errorf("a tag cannot be empty")
+	}
+	if len(normalized) > MAX_TAG_LENGTH {
+		return "", fmt.Errorf("the tag '%v' is longer than %v characters", tag, MAX_TAG_LENGTH)
+	}
+	if !validTag.MatchString(normalized) {
+		return "", fmt.Errorf("the tag '%v' can only have letters, digits and . _ / - (after the first character)", tag)
+	}
+	return normalized, nil
+}
+
+// tagDashes is a run of "-" left by SanitizeTag
+var tagDashes = regexp.MustCompile(`-{2,}`)
+
+// SanitizeTag makes a valid tag out of any name: characters a tag cannot
+// have become "-" ("Social & Fun" becomes "social-fun") and it is cut to
+// MAX_TAG_LENGTH. It is "" when nothing is left.
+func SanitizeTag(tag string) string {
+	allowed := func(r rune) bool {
+		return unicode.IsLower(r) || unicode.Is(unicode.Lo, r) || unicode.IsNumber(r)
+	}
+	sanitized := strings.Map(func(r rune) rune {
+		if allowed(r) || strings.ContainsRune("._/-", r) {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(tag))
+	sanitized = strings.TrimLeftFunc(tagDashes.ReplaceAllString(sanitized, "-"), func(r rune) bool { return !allowed(r) })
+	for len(sanitized) > MAX_TAG_LENGTH {
+		runes := []rune(sanitized)
+		sanitized = string(runes[:len(runes)-1])
+	}
+	return strings.TrimRight(sanitized, "-")
+}
+
+// tagSet turns a list of tag names into the map stored on an entry; names
+// are normalized, sanitized when they cannot be, and dropped when nothing
+// is left
+func tagSet(tags []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, tag := range tags {
+		normalized, err := NormalizeTag(tag)
+		if err != nil {
+			normalized, err = NormalizeTag(SanitizeTag(tag))
+		}
+		if err == nil {
+			set[normalized] = true
+		}
+	}
+	return set
+}
+
+// HasTag is true when the entry has the tag, comparing normalized names so
+// tags stored before normalization still match
+func (e DBEntry) HasTag(tag string) bool {
+	return e.findTag(tag) != ""
+}
+
+// findTag returns the tag as it is stored on the entry, or ""
+func (e DBEntry) findTag(tag string) string {
+	want, err := NormalizeTag(tag)
+	if err != nil {
+		return ""
+	}
+	for _, stored := range e.TagList() {
+		if normalized, _ := NormalizeTag(stored); normalized == want || stored == tag {
+			return stored
+		}
+	}
+	return ""
+}
+
+// TagCount is a tag and the number of entries that have it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// CountTags counts every tag in the vault, most used first; tags stored
+// before normalization count as their normalized name, as HasTag matches
+func CountTags(db *KPDB) []TagCount {
+	counts := make(map[string]int)
+	for _, entry := range db.GetData().Entries {
+		seen := make(map[string]bool)
+		for _, tag := range entry.TagList() {
+			if normalized, err := NormalizeTag(tag); err == nil {
+				tag = normalized
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				counts[tag]++
+			}
+		}
+	}
+	result := make([]TagCount, 0)
+	for tag, count := range counts {
+		result = append(result, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result, func(a int, b int) bool {
+		if result[a].Count != result[b].Count {
+			return result[a].Count > result[b].Count
+		}
+		return result[a].Tag < result[b].Tag
+	})
+	return result
+}
+
+// RenameTag renames (or, when to is "", removes) a tag on every entry that
+// has it, returning how many were changed. The db is not saved.
+func RenameTag(db *KPDB, from string, to string) int {
+	changed := 0
+	now := time.Now()
+	for key, entry := range db.GetData().Entries {
+		stored := entry.findTag(from)
+		if stored == "" {
+			continue
+		}
+		tags := make(map[string]bool)
+		for tag, on := range entry.Tags {
+			tags[tag] = on
+		}
+		delete(tags, stored)
+		if to != "" {
+			tags[to] = true
+		}
+		entry.Tags = tags
+		entry.LastUpdated = now
+		db.GetData().Entries[key] = entry
+		changed++
+	}
+	return changed
+}
+
+// DoTags is "kp tags", "kp tags rename <old> <new>" and "kp tags rm <tag>"
+func DoTags(c *cli.CLI) {
+	positionals := Positionals(c)
+	db := LoadDB()
+	if len(positionals) == 0 {
+		counts := CountTags(db)
+		if IsJSON(c) {
+			PrintJSONList(c, counts)
+			return
+		}
+		if len(counts) == 0 {
+			fmt.Println("No tags.")
+			return
+		}
+		for _, tc := range counts {
+			fmt.Printf("%5d  %v\n", tc.Count, tc.Tag)
+		}
+		return
+	}
+
+	action := positionals[0]
+	switch {
+	case action == "rename" && len(positionals) == 3:
+		to, err := NormalizeTag(positionals[2])
+		if err != nil {
+			fmt.Printf("Error, %v\n", err)
+			os.Exit(1)
+		}
+		changed := RenameTag(db, positionals[1], to)
+		db.Save()
+		fmt.Printf("Renamed '%v' to '%v' on %v entries.\n", positionals[1], to, changed)
+	case action == "rm" && len(positionals) == 2:
+		changed := RenameTag(db, positionals[1], "")
+		db.Save()
+		fmt.Printf("Removed '%v' from %v entries.\n", positionals[1], changed)
+	default:
+		fmt.Printf("Usage: kp tags [rename <old> <new> | rm <tag>]\n")
+		os.Exit(1)
+	}
+}
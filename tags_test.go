@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	valid := map[string]string{
+		"work":          "work",
+		" Work Laptop ": "work-laptop",
+		"team/infra":    "team/infra",
+		"v1.2":          "v1.2",
+		"Ünïcode":       "ünïcode",
+	}
+	for tag, expected := range valid {
+		if normalized, err := NormalizeTag(tag); err != nil || normalized != expected {
+			t.Errorf("NormalizeTag(%q) = %q, %v; expected %q", tag, normalized, err, expected)
+		}
+	}
+	for _, tag := range []string{"", "  ", "-work", "work,prod", "a:b", string(make([]byte, MAX_TAG_LENGTH+1))} {
+		if _, err := NormalizeTag(tag); err == nil {
+			t.Errorf("expected NormalizeTag(%q) to fail", tag)
+		}
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	sanitized := map[string]string{
+		"Social & Fun":   "social-fun",
+		"-work,prod-":    "work-prod",
+		"a:b":            "a-b",
+		"&&&":            "",
+		"Work Laptop":    "work-laptop",
+		"team/infra/ops": "team/infra/ops",
+	}
+	for tag, expected := range sanitized {
+		if got := SanitizeTag(tag); got != expected {
+			t.Errorf("SanitizeTag(%q) = %q; expected %q", tag, got, expected)
+		}
+	}
+	if tag := SanitizeTag(strings.Repeat("ä", MAX_TAG_LENGTH)); len(tag) > MAX_TAG_LENGTH {
+		t.Errorf("expected the tag to be cut to %v bytes, got %v", MAX_TAG_LENGTH, len(tag))
+	}
+	if set := tagSet([]string{"Social & Fun", "&"}); len(set) != 1 || !set["social-fun"] {
+		t.Errorf("expected the tag to be sanitized, got %v", set)
+	}
+}
+
+func TestCountAndRenameTags(t *testing.T) {
+	db := newTestDB(t)
+	db.Put(DBEntry{Key: "a", Value: "1", Tags: map[string]bool{"work": true, "prod": true}})
+	db.Put(DBEntry{Key: "b", Value: "2", Tags: map[string]bool{"Work": true}})
+	db.Put(DBEntry{Key: "c", Value: "3"})
+
+	// the stored "Work" predates normalization and counts as "work"
+	counts := CountTags(db)
+	if len(counts) != 2 || counts[0] != (TagCount{Tag: "work", Count: 2}) {
+		t.Fatalf("unexpected counts %+v", counts)
+	}
+
+	// the stored "Work" predates normalization and is renamed too
+	if changed := RenameTag(db, "work", "office"); changed != 2 {
+		t.Fatalf("expected 2 entries renamed, got %v", changed)
+	}
+	counts = CountTags(db)
+	if len(counts) != 2 || counts[0] != (TagCount{Tag: "office", Count: 2}) {
+		t.Fatalf("unexpected counts after rename %+v", counts)
+	}
+
+	if changed := RenameTag(db, "prod", ""); changed != 1 {
+		t.Fatalf("expected 1 entry untagged, got %v", changed)
+	}
+	a, _ := db.GetDecrypted("a")
+	if a.HasTag("prod") || !a.HasTag("OFFICE") || a.Value != "1" {
+		t.Fatalf("unexpected entry %+v", a)
+	}
+}
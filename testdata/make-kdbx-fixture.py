@@ -0,0 +1,176 @@
+#!/usr/bin/env python3
+"""Writes testdata/fixture.kdbx, a KDBX 4.0 file laid out the way KeePassXC
+writes one (AES-256 payload, gzip, ChaCha20 inner stream, a recycle bin,
+history and custom fields), to test kp's reader against a second, independent
+implementation of the format. It uses the AES-KDF so that only the standard
+library and the openssl command are needed.
+
+    python3 testdata/make-kdbx-fixture.py  (master password: fixture)
+"""
+
+import base64
+import gzip
+import hashlib
+import hmac
+import os
+import struct
+import subprocess
+
+PASSWORD = b"fixture"
+OUT = os.path.join(os.path.dirname(os.path.abspath(__file__)), "fixture.kdbx")
+
+CIPHER_AES256 = bytes.fromhex("31c1f2e6bf714350be5805216afc5aff")
+KDF_AES = bytes.fromhex("c9d9f39a628a4460bf740d08c18a4fea")
+ROUNDS = 64
+
+
+def openssl(cipher, key, data, iv=None):
+    args = ["openssl", "enc", "-" + cipher, "-K", key.hex(), "-nosalt"]
+    if iv is not None:
+        args += ["-iv", iv.hex()]
+    else:
+        args += ["-nopad"]
+    return subprocess.run(args, input=data, stdout=subprocess.PIPE, check=True).stdout
+
+
+def chacha20_block(key, counter, nonce):
+    def rotl(v, c):
+        return ((v << c) & 0xFFFFFFFF) | (v >> (32 - c))
+
+    def quarter(s, a, b, c, d):
+        s[a] = (s[a] + s[b]) & 0xFFFFFFFF; s[d] = rotl(s[d] ^ s[a], 16)
+        s[c] = (s[c] + s[d]) & 0xFFFFFFFF; s[b] = rotl(s[b] ^ s[c], 12)
+        s[a] = (s[a] + s[b]) & 0xFFFFFFFF; s[d] = rotl(s[d] ^ s[a], 8)
+        s[c] = (s[c] + s[d]) & 0xFFFFFFFF; s[b] = rotl(s[b] ^ s[c], 7)
+
+    state = [0x61707865, 0x3320646E, 0x79622D32, 0x6B206574]
+    state += list(struct.unpack("<8I", key)) + [counter] + list(struct.unpack("<3I", nonce))
+    s = list(state)
+    for _ in range(10):
+        quarter(s, 0, 4, 8, 12); quarter(s, 1, 5, 9, 13); quarter(s, 2, 6, 10, 14); quarter(s, 3, 7, 11, 15)
+        quarter(s, 0, 5, 10, 15); quarter(s, 1, 6, 11, 12); quarter(s, 2, 7, 8, 13); quarter(s, 3, 4, 9, 14)
+    return struct.pack("<16I", *[(a + b) & 0xFFFFFFFF for a, b in zip(s, state)])
+
+
+class ChaCha20:
+    def __init__(self, key, nonce):
+        self.key, self.nonce, self.counter, self.buffer = key, nonce, 0, b""
+
+    def xor(self, data):
+        while len(self.buffer) < len(data):
+            self.buffer += chacha20_block(self.key, self.counter, self.nonce)
+            self.counter += 1
+        stream, self.buffer = self.buffer[:len(data)], self.buffer[len(data):]
+        return bytes(a ^ b for a, b in zip(data, stream))
+
+
+# RFC 8439 section 2.3.2
+assert chacha20_block(bytes(range(32)), 1, bytes.fromhex("000000090000004a00000000"))[:4].hex() == "10f1e7e4"
+
+
+def variant_dictionary(items):
+    out = struct.pack("<H", 0x0100)
+    for name, kind, value in items:
+        data = {0x05: lambda v: struct.pack("<Q", v), 0x04: lambda v: struct.pack("<I", v), 0x42: lambda v: v}[kind](value)
+        out += bytes([kind]) + struct.pack("<I", len(name)) + name.encode() + struct.pack("<I", len(data)) + data
+    return out + b"\x00"
+
+
+def field(kind, data):
+    return bytes([kind]) + struct.pack("<I", len(data)) + data
+
+
+def kdbx_time(year, month, day, hour=12):
+    # seconds since 0001-01-01, as KDBX 4 stores them
+    import datetime
+    seconds = int((datetime.datetime(year, month, day, hour) - datetime.datetime(1, 1, 1)).total_seconds())
+    return base64.b64encode(struct.pack("<Q", seconds)).decode()
+
+
+def uuid(n):
+    return base64.b64encode(bytes([n]) * 16).decode()
+
+
+master_seed = bytes(range(32))
+iv = bytes(range(100, 116))
+kdf_seed = bytes(range(200, 232))
+inner_key = bytes(range(64))
+
+header = b"\x03\xd9\xa2\x9a" + b"\x67\xfb\x4b\xb5" + struct.pack("<HH", 0, 4)
+header += field(2, CIPHER_AES256)
+header += field(3, struct.pack("<I", 1))
+header += field(4, master_seed)
+header += field(7, iv)
+header += field(11, variant_dictionary([("$UUID", 0x42, KDF_AES), ("R", 0x05, ROUNDS), ("S", 0x42, kdf_seed)]))
+header += field(0, b"\r\n\r\n")
+
+composite = hashlib.sha256(hashlib.sha256(PASSWORD).digest()).digest()
+transformed = composite
+for _ in range(ROUNDS):
+    transformed = openssl("aes-256-ecb", kdf_seed, transformed)
+transformed = hashlib.sha256(transformed).digest()
+encryption_key = hashlib.sha256(master_seed + transformed).digest()
+hmac_base = hashlib.sha512(master_seed + transformed + b"\x01").digest()
+
+
+def block_key(index):
+    return hashlib.sha512(struct.pack("<Q", index) + hmac_base).digest()
+
+
+inner_hash = hashlib.sha512(inner_key).digest()
+stream = ChaCha20(inner_hash[:32], inner_hash[32:44])
+
+
+def protect(text):
+    return base64.b64encode(stream.xor(text.encode())).decode()
+
+
+def string(key, value, protected=False):
+    if protected:
+        return f'<String><Key>{key}</Key><Value Protected="True">{protect(value)}</Value></String>'
+    return f"<String><Key>{key}</Key><Value>{value}</Value></String>"
+
+
+def times(created, modified):
+    return (f"<Times><LastModificationTime>{modified}</LastModificationTime><CreationTime>{created}</CreationTime>"
+            f"<LastAccessTime>{modified}</LastAccessTime><ExpiryTime>{modified}</ExpiryTime><Expires>False</Expires>"
+            f"<UsageCount>0</UsageCount><LocationChanged>{modified}</LocationChanged></Times>")
+
+
+# protected values are encrypted in document order, so the XML is built in order
+created, modified, old = kdbx_time(2021, 3, 4), kdbx_time(2023, 6, 7), kdbx_time(2022, 1, 2)
+aws = (f"<Entry><UUID>{uuid(2)}</UUID><IconID>0</IconID><ForegroundColor/><BackgroundColor/><OverrideURL/>"
+       f"<Tags>cloud;prod</Tags>{times(created, modified)}"
+       + string("Notes", "root account &amp; billing")
+       + string("Password", "s3cret with spaces ", True)
+       + string("Title", "AWS")
+       + string("URL", "https://aws.amazon.com")
+       + string("UserName", "admin")
+       + string("Account ID", "123456789012")
+       + string("Recovery code", "rc-0001", True)
+       + "<AutoType><Enabled>True</Enabled><DataTransferObfuscation>0</DataTransferObfuscation></AutoType>"
+       + f"<History><Entry><UUID>{uuid(2)}</UUID><IconID>0</IconID><Tags/>{times(created, old)}"
+       + string("Password", "old-password", True) + string("Title", "AWS")
+       + "</Entry></History></Entry>")
+social = (f"<Entry><UUID>{uuid(4)}</UUID><IconID>0</IconID><Tags/>{times(created, created)}"
+          + string("Notes", "") + string("Password", "hunter2", True) + string("Title", "Forum")
+          + string("URL", "") + string("UserName", "bob") + "</Entry>")
+deleted = (f"<Entry><UUID>{uuid(6)}</UUID><IconID>0</IconID><Tags/>{times(created, created)}"
+           + string("Password", "gone", True) + string("Title", "Deleted") + "</Entry>")
+
+xml = f"""<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<KeePassFile><Meta><Generator>KeePassXC</Generator><DatabaseName>Fixture</DatabaseName><DatabaseNameChanged>{created}</DatabaseNameChanged><MemoryProtection><ProtectTitle>False</ProtectTitle><ProtectUserName>False</ProtectUserName><ProtectPassword>True</ProtectPassword><ProtectURL>False</ProtectURL><ProtectNotes>False</ProtectNotes></MemoryProtection><RecycleBinEnabled>True</RecycleBinEnabled><RecycleBinUUID>{uuid(5)}</RecycleBinUUID><CustomData/></Meta><Root><Group><UUID>{uuid(1)}</UUID><Name>Root</Name><Notes/><IconID>48</IconID>{times(created, created)}<IsExpanded>True</IsExpanded><Group><UUID>{uuid(3)}</UUID><Name>Work</Name><Notes/><IconID>48</IconID>{times(created, created)}<Group><UUID>{uuid(7)}</UUID><Name>Cloud</Name><Notes/><IconID>48</IconID>{times(created, created)}{aws}</Group></Group><Group><UUID>{uuid(8)}</UUID><Name>Social &amp; Fun</Name><Notes/><IconID>48</IconID>{times(created, created)}{social}</Group><Group><UUID>{uuid(5)}</UUID><Name>Recycle Bin</Name><Notes/><IconID>43</IconID>{times(created, created)}{deleted}</Group></Group><DeletedObjects/></Root></KeePassFile>
+"""
+
+inner = field(1, struct.pack("<I", 3)) + field(2, inner_key) + field(0, b"")
+payload = openssl("aes-256-cbc", encryption_key, gzip.compress(inner + xml.encode(), mtime=0), iv)
+
+out = header + hashlib.sha256(header).digest()
+out += hmac.new(block_key(0xFFFFFFFFFFFFFFFF), header, hashlib.sha256).digest()
+for index, block in enumerate([payload, b""]):
+    size = struct.pack("<I", len(block))
+    out += hmac.new(block_key(index), struct.pack("<Q", index) + size + block, hashlib.sha256).digest() + size + block
+
+with open(OUT, "wb") as f:
+    f.write(out)
+print(f"wrote {OUT} ({len(out)} bytes)")